@@ -0,0 +1,289 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+
+	datafusion "mainprocess/datafusion"
+	"mainprocess/model"
+	"mainprocess/pipeline"
+	"mainprocess/tracker"
+	"mainprocess/transport"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// runCommand executes one of the commands of the process instead of the main process
+func runCommand(name string, args []string) error {
+	switch name {
+	case "shadow-summary":
+		return shadowSummaryCommand(args)
+	case "export":
+		return exportCommand(args)
+	case "erase":
+		return eraseCommand(args)
+	case "retention":
+		return retentionCommand(args)
+	case "replay":
+		return replayCommand(args)
+	}
+	return fmt.Errorf("Unknown command %s. Available commands: shadow-summary, export, erase, retention, replay", name)
+}
+
+// shadowSummaryCommand prints the agreement between the shadow and the production models
+func shadowSummaryCommand(args []string) error {
+	flags := flag.NewFlagSet("shadow-summary", flag.ContinueOnError)
+	viper.SetDefault("ml.shadowStatsFile", "./data/shadow_stats.json")
+	statsFile := flags.String("file", viper.GetString("ml.shadowStatsFile"), "File with the shadow stats")
+	reset := flags.Bool("reset", false, "Remove the stats after printing them")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	stats, err := model.LoadShadowStats(*statsFile)
+	if err != nil {
+		return fmt.Errorf("Can't read shadow stats: %v", err.Error())
+	}
+	fmt.Print(stats.Summary())
+	if *reset {
+		return model.ResetShadowStats(*statsFile)
+	}
+	return nil
+}
+
+// exportCommand writes the stored locations of a time range in CSV or JSON lines
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	from := flags.String("from", "", "Start of the time range in RFC3339, included")
+	to := flags.String("to", "", "End of the time range in RFC3339, excluded")
+	person := flags.String("person", "", "Only export the locations of this person")
+	room := flags.String("room", "", "Only export the locations of this room")
+	format := flags.String("format", tracker.ExportCSV, "Format of the export: csv or jsonl")
+	out := flags.String("out", "", "Output file. The standard output when empty")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	query := tracker.LocationQuery{Room: *room}
+	for _, t := range []struct {
+		value  string
+		target *time.Time
+	}{{*from, &query.From}, {*to, &query.To}} {
+		if t.value == "" {
+			continue
+		}
+		*t.target, err = time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return fmt.Errorf("Invalid time %s, expected RFC3339", t.value)
+		}
+	}
+	if *person != "" {
+		id, err := strconv.Atoi(*person)
+		if err != nil {
+			return fmt.Errorf("Invalid person %s", *person)
+		}
+		query.Person = &id
+	}
+
+	_, store, err := openLocationStore(true)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	count, err := tracker.Export(store, query, *format, w)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		fmt.Printf("Exported %d locations to %s\n", count, *out)
+	}
+	return nil
+}
+
+// eraseCommand removes or pseudonymizes the stored locations of a person
+func eraseCommand(args []string) error {
+	flags := flag.NewFlagSet("erase", flag.ContinueOnError)
+	person := flags.Int("person", -1, "Person whose locations are erased")
+	pseudonymize := flags.Bool("pseudonymize", false, "Replace the person with a random pseudonym instead of removing the locations")
+	operator := flags.String("operator", currentUser(), "Operator requesting the erasure, written in the audit file")
+	reason := flags.String("reason", "", "Reason of the erasure, written in the audit file")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *person < 0 {
+		return fmt.Errorf("The person to erase is required")
+	}
+
+	config, store, err := openLocationStore(false)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	entry, err := tracker.ErasePerson(store, *person, *pseudonymize, *operator, *reason, config.AuditFile)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Applied %s to %d locations of user %d, audited in %s\n", entry.Action, entry.Records, entry.Person, config.AuditFile)
+	return nil
+}
+
+// retentionCommand applies the retention policy once
+func retentionCommand(args []string) error {
+	config := tracker.ReadConfig()
+	flags := flag.NewFlagSet("retention", flag.ContinueOnError)
+	days := flags.Int("days", config.RetentionDays, "Keep the locations of the last days")
+	policy := flags.String("policy", config.RetentionPolicy, "Retention policy: delete or aggregate")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *days <= 0 {
+		return fmt.Errorf("The number of days to keep is required")
+	}
+
+	_, store, err := openLocationStore(false)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	cutoff := tracker.RetentionCutoff(time.Now(), *days)
+	removed, err := tracker.ApplyRetention(store, *policy, config.AggregateFile, cutoff)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Applied %s policy to %d locations recorded before %s\n", *policy, removed, cutoff.Format(time.RFC3339))
+	return nil
+}
+
+// replayCommand feeds a recording through the fusion and the model, and writes the detections
+func replayCommand(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	file := flags.String("file", "", "Recording to replay, written with record.file")
+	realtime := flags.Bool("realtime", false, "Keep the recorded time between the messages instead of replaying them as fast as possible")
+	out := flags.String("out", "", "Output file of the detections, one JSON per line. The standard output when empty")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("The recording to replay is required")
+	}
+
+	replay, err := transport.OpenReplay(*file)
+	if err != nil {
+		return err
+	}
+	config := pipeline.ReadConfig()
+	// The replay only predicts, it never changes the locations, the alarms, the shadow stats or the
+	// online weights
+	config.Embedded = false
+	config.APIAddress = ""
+	config.RecordFile = ""
+	config.Model.ShadowModelFile = ""
+	config.Online.WeightsFile = ""
+	// The model is only read from the model file, never trained, persisted or reloaded
+	classifier := model.NewManager(config.Model.TrainFile, config.Model.TestFile, config.Model.ModelFile)
+	classifier.ReadOnly = true
+	classifier.Features = len(datafusion.FeatureNames)
+	classifier.Training = config.Model.Training
+	err = classifier.Load()
+	if err != nil {
+		return fmt.Errorf("Can't load the model to replay: %v", err.Error())
+	}
+	fusion, err := pipeline.New(pipeline.WithConfig(config), pipeline.WithTransport(replay), pipeline.WithClassifier(classifier))
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fusion.Stop()
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	var (
+		mu         sync.Mutex
+		detections int
+		writeErr   error
+	)
+	replay.Subscribe("/Nodes/+/Tracking/Detection", func(msg transport.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		detections++
+		_, err := fmt.Fprintln(w, string(msg.Payload))
+		if err != nil && writeErr == nil {
+			writeErr = err
+		}
+	})
+
+	if *realtime {
+		err = fusion.Start()
+		if err != nil {
+			fusion.Stop()
+			return err
+		}
+		replay.Run(true)
+	} else {
+		err = fusion.Replay(replay.Records())
+		if err != nil {
+			fusion.Stop()
+			return err
+		}
+	}
+	// Stopping also predicts the last window of the realtime replay
+	err = fusion.Stop()
+	if err != nil {
+		return err
+	}
+	log.Infof("[Replay] Replayed %d messages of %s with %d detections", len(replay.Records()), *file, detections)
+	return writeErr
+}
+
+// openLocationStore opens the location store of the tracker configuration, read-only to only read
+// it. It fails while the main process or the tracker daemon have the store open
+func openLocationStore(readOnly bool) (tracker.Config, tracker.LocationStore, error) {
+	config := tracker.ReadConfig()
+	open := tracker.OpenLocationStore
+	if readOnly {
+		open = tracker.OpenLocationStoreReadOnly
+	}
+	store, err := open(config.Storage, config.StoragePath)
+	if err != nil {
+		return config, nil, fmt.Errorf("Can't open location store %s: %v", config.StoragePath, err.Error())
+	}
+	return config, store, nil
+}
+
+func currentUser() string {
+	current, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return current.Username
+}
@@ -2,6 +2,7 @@ package mainprocess
 
 import (
 	"encoding/json"
+	"fmt"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -11,6 +12,8 @@ type (
 		Sensor    string `json:"sensor"`
 		Timestamp string `json:"timestamp"`
 		Person    int    `json:"person"`
+		// Label is the re-identification label of the camera, resolved to the person
+		Label string `json:"label,omitempty"`
 	}
 
 	presenceStruct struct {
@@ -24,6 +27,8 @@ type (
 		Timestamp string  `json:"timestamp"`
 		Person    int     `json:"person"`
 		Power     float64 `json:"power"`
+		// Epc is the ID of the tag, resolved to the person
+		Epc string `json:"epc,omitempty"`
 	}
 
 	wifiStruct struct {
@@ -31,6 +36,15 @@ type (
 		Timestamp string  `json:"timestamp"`
 		Person    int     `json:"person"`
 		Rssi      float64 `json:"rssi"`
+		// Mac is the address of the device, resolved to the person
+		Mac string `json:"mac,omitempty"`
+	}
+
+	// Resolver finds the person identified by the raw identifier of a device
+	Resolver interface {
+		CameraPerson(label string) (int, bool)
+		RfidPerson(epc string) (int, bool)
+		WifiPerson(mac string) (int, bool)
 	}
 
 	// CollectData stores all the structs with received data
@@ -39,6 +53,9 @@ type (
 		Presence []presenceStruct
 		Rfid     []rfidStruct
 		Wifi     []wifiStruct
+		// Resolver sets the person of the data with a device identifier. When nil, only the person
+		// in the data is used
+		Resolver Resolver
 	}
 )
 
@@ -51,6 +68,12 @@ func (c *CollectData) AddNewValue(payload []byte, topic string) error {
 		if err != nil {
 			return err
 		}
+		if data.Label != "" {
+			data.Person, err = c.resolve("camera label", data.Label, Resolver.CameraPerson)
+			if err != nil {
+				return err
+			}
+		}
 		c.Camera = append(c.Camera, data)
 		log.Tracef("Camera detected")
 	case "presence":
@@ -67,6 +90,12 @@ func (c *CollectData) AddNewValue(payload []byte, topic string) error {
 		if err != nil {
 			return err
 		}
+		if data.Epc != "" {
+			data.Person, err = c.resolve("RFID tag", data.Epc, Resolver.RfidPerson)
+			if err != nil {
+				return err
+			}
+		}
 		c.Rfid = append(c.Rfid, data)
 		log.Tracef("RFID detected")
 	case "wifi":
@@ -75,8 +104,26 @@ func (c *CollectData) AddNewValue(payload []byte, topic string) error {
 		if err != nil {
 			return err
 		}
+		if data.Mac != "" {
+			data.Person, err = c.resolve("WiFi MAC", data.Mac, Resolver.WifiPerson)
+			if err != nil {
+				return err
+			}
+		}
 		c.Wifi = append(c.Wifi, data)
 		log.Tracef("WiFi detected")
 	}
 	return nil
 }
+
+// resolve finds the person of a device identifier with a lookup of the resolver
+func (c *CollectData) resolve(kind, id string, lookup func(Resolver, string) (int, bool)) (int, error) {
+	if c.Resolver == nil {
+		return 0, fmt.Errorf("Can't resolve %s %s without a person directory", kind, id)
+	}
+	person, ok := lookup(c.Resolver, id)
+	if !ok {
+		return 0, fmt.Errorf("Unknown %s %s", kind, id)
+	}
+	return person, nil
+}
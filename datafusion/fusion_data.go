@@ -18,12 +18,17 @@ type (
 		WifiUser   float64 `json:"wifiuser"`
 		WifiRssi   float64 `json:"wifirssi"`
 		Detection  bool    `json:"detection"`
+		// Window identifies the window where the data was collected, used to send feedback about the prediction
+		Window string `json:"window,omitempty"`
 	}
 
 	//FinalData to test
 	FinalData []PredictionDataStruct
 )
 
+// FeatureNames are the names of the columns returned by To2DFloatArray, in the same order
+var FeatureNames = []string{"presence", "wifiuser", "wifirssi", "rfiduser", "rfidpower", "camerauser"}
+
 //ObtainFinalData returns the final list of struct to predict
 func (f *FinalData) ObtainFinalData(data JoinedData) {
 	finalTimestamp := data.Camera.Timestamp
@@ -186,7 +191,8 @@ func (f *FinalData) isPersonEntryCreated(person int) bool {
 	return false
 }
 
-// To2DFloatArray converts the array of PredictionDataStruct in a 2D Array of float64
+// To2DFloatArray converts the array of PredictionDataStruct in a 2D Array of float64. The columns
+// are in the order of FeatureNames
 func (f *FinalData) To2DFloatArray() (data [][]float64) {
 	for _, v := range *f {
 		d := []float64{
@@ -0,0 +1,67 @@
+package mainprocess
+
+import (
+	"sort"
+)
+
+type (
+	// TailgatingConfig has the thresholds of the tailgating analyzer
+	TailgatingConfig struct {
+		// MinCameraDetections is the number of camera detections needed to count a person
+		MinCameraDetections int
+		// MinPresence is the percentage of positive presence readings needed to consider that someone entered
+		MinPresence float64
+		// MinUnbadged is the number of persons without badge needed to raise the alarm
+		MinUnbadged int
+	}
+
+	// Tailgating is the result of comparing the persons seen by the camera with the RFID badges of a window
+	Tailgating struct {
+		Timestamp     string  `json:"timestamp"`
+		CameraPersons int     `json:"camerapersons"`
+		Badges        int     `json:"badges"`
+		Presence      float64 `json:"presence"`
+		// Unbadged are the persons seen by the camera without a RFID read
+		Unbadged []int `json:"unbadged"`
+		// Detected is true when more persons than badges entered with at least one badge
+		Detected bool `json:"detected"`
+	}
+)
+
+// AnalyzeTailgating compares the number of persons seen by the camera and the presence detector with
+// the number of distinct RFID badges of a window. Tailgating happens when at least one badge was read,
+// but more persons entered
+func (g *JoinedData) AnalyzeTailgating(config TailgatingConfig) Tailgating {
+	result := Tailgating{
+		Timestamp: g.Camera.Timestamp,
+		Presence:  g.Presence.Detection,
+		Unbadged:  []int{},
+	}
+	if result.Timestamp == "" {
+		result.Timestamp = g.Rfid.Timestamp
+	}
+
+	badges := make(map[int]bool)
+	for _, v := range g.Rfid.PersonCount {
+		if v.Count > 0 {
+			badges[v.Person] = true
+		}
+	}
+	result.Badges = len(badges)
+
+	for _, v := range g.Camera.PersonCount {
+		if v.Count < config.MinCameraDetections {
+			continue
+		}
+		result.CameraPersons++
+		if !badges[v.Person] {
+			result.Unbadged = append(result.Unbadged, v.Person)
+		}
+	}
+	sort.Ints(result.Unbadged)
+
+	result.Detected = result.Badges > 0 &&
+		result.CameraPersons-result.Badges >= config.MinUnbadged &&
+		result.Presence >= config.MinPresence
+	return result
+}
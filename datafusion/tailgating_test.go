@@ -0,0 +1,53 @@
+package mainprocess
+
+import (
+	"reflect"
+	"testing"
+)
+
+// joinedWindow creates the joined data of a window with the camera counts and RFID badges of each person
+func joinedWindow(camera map[int]int, badges []int, presence float64) JoinedData {
+	var g JoinedData
+	g.Camera.Timestamp = "2020-07-01T10:00:00Z"
+	for person, count := range camera {
+		g.Camera.PersonCount = append(g.Camera.PersonCount, cameraStructCountFinal{Person: person, Count: count})
+	}
+	for _, person := range badges {
+		g.Rfid.PersonCount = append(g.Rfid.PersonCount, rfidStructCountFinal{Person: person, Count: 1, Power: -50})
+	}
+	g.Presence.Detection = presence
+	return g
+}
+
+func TestAnalyzeTailgating(t *testing.T) {
+	config := TailgatingConfig{MinCameraDetections: 2, MinPresence: 50, MinUnbadged: 1}
+	tests := []struct {
+		name     string
+		window   JoinedData
+		camera   int
+		badges   int
+		unbadged []int
+		detected bool
+	}{
+		{"everyone badged", joinedWindow(map[int]int{1: 3, 2: 3}, []int{1, 2}, 80), 2, 2, []int{}, false},
+		{"one person without badge", joinedWindow(map[int]int{1: 3, 2: 3, 3: 2}, []int{1}, 80), 3, 1, []int{2, 3}, true},
+		{"few camera detections", joinedWindow(map[int]int{1: 3, 2: 1}, []int{1}, 80), 1, 1, []int{}, false},
+		{"no badge read", joinedWindow(map[int]int{1: 3, 2: 3}, nil, 80), 2, 0, []int{1, 2}, false},
+		{"low presence", joinedWindow(map[int]int{1: 3, 2: 3}, []int{1}, 20), 2, 1, []int{2}, false},
+		{"repeated badge", joinedWindow(map[int]int{1: 3, 2: 3}, []int{1, 1}, 80), 2, 1, []int{2}, true},
+	}
+	for _, test := range tests {
+		analysis := test.window.AnalyzeTailgating(config)
+		if analysis.CameraPersons != test.camera || analysis.Badges != test.badges || !reflect.DeepEqual(analysis.Unbadged, test.unbadged) || analysis.Detected != test.detected {
+			t.Errorf("%s: analysis = %+v, want %d camera persons, %d badges, unbadged %v and detected %v",
+				test.name, analysis, test.camera, test.badges, test.unbadged, test.detected)
+		}
+	}
+
+	// More persons without badge can be required
+	config.MinUnbadged = 2
+	window := joinedWindow(map[int]int{1: 3, 2: 3}, []int{1}, 80)
+	if analysis := window.AnalyzeTailgating(config); analysis.Detected {
+		t.Errorf("Analysis with 1 person without badge = %+v, want not detected with 2 required", analysis)
+	}
+}
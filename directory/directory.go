@@ -0,0 +1,238 @@
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mainprocess/files"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// reloadDelay is the time waited after the last file event before reloading the directory
+const reloadDelay = 500 * time.Millisecond
+
+type (
+	// Person is a human with the identifiers of the devices that detect them
+	Person struct {
+		ID     int      `json:"id" yaml:"id"`
+		Name   string   `json:"name" yaml:"name"`
+		Groups []string `json:"groups" yaml:"groups"`
+		// RfidTags are the EPCs of the tags carried by the person
+		RfidTags []string `json:"rfidtags" yaml:"rfidtags"`
+		// WifiMacs are the MAC addresses of the devices of the person
+		WifiMacs []string `json:"wifimacs" yaml:"wifimacs"`
+		// CameraLabels are the re-identification labels given by the cameras to the person
+		CameraLabels []string `json:"cameralabels" yaml:"cameralabels"`
+	}
+
+	// Entries is the content of a directory file
+	Entries struct {
+		Persons []Person `json:"persons" yaml:"persons"`
+	}
+
+	// Directory resolves the identifiers of the devices to persons. It's loaded from a file and
+	// reloaded when the file changes
+	Directory struct {
+		file string
+
+		mu      sync.RWMutex
+		persons map[int]Person
+		rfid    map[string]int
+		wifi    map[string]int
+		camera  map[string]int
+
+		watcher *files.Watcher
+	}
+)
+
+// Load creates a directory with the persons of a YAML, JSON or CSV file
+func Load(file string) (*Directory, error) {
+	d := &Directory{file: file}
+	err := d.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Reload reads again the persons from the file. If the file is invalid, the previous persons are kept
+func (d *Directory) Reload() error {
+	entries, err := readEntries(d.file)
+	if err != nil {
+		return fmt.Errorf("Can't load person directory %s: %v", d.file, err.Error())
+	}
+
+	persons := make(map[int]Person)
+	rfid := make(map[string]int)
+	wifi := make(map[string]int)
+	camera := make(map[string]int)
+	for _, person := range entries.Persons {
+		if _, ok := persons[person.ID]; ok {
+			return fmt.Errorf("Can't load person directory %s: duplicated person %d", d.file, person.ID)
+		}
+		persons[person.ID] = person
+		for _, index := range []struct {
+			kind        string
+			ids         []string
+			normalize   func(string) string
+			identifiers map[string]int
+		}{
+			{"RFID tag", person.RfidTags, normalizeEpc, rfid},
+			{"WiFi MAC", person.WifiMacs, normalizeMac, wifi},
+			{"camera label", person.CameraLabels, normalizeLabel, camera},
+		} {
+			for _, id := range index.ids {
+				key := index.normalize(id)
+				if other, ok := index.identifiers[key]; ok && other != person.ID {
+					return fmt.Errorf("Can't load person directory %s: %s %s assigned to persons %d and %d", d.file, index.kind, id, other, person.ID)
+				}
+				index.identifiers[key] = person.ID
+			}
+		}
+	}
+
+	d.mu.Lock()
+	d.persons, d.rfid, d.wifi, d.camera = persons, rfid, wifi, camera
+	d.mu.Unlock()
+	log.Infof("[Directory] Loaded %d persons from %s", len(persons), d.file)
+	return nil
+}
+
+// Person returns a person by the ID
+func (d *Directory) Person(id int) (Person, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	person, ok := d.persons[id]
+	return person, ok
+}
+
+// Persons returns every person of the directory, sorted by ID
+func (d *Directory) Persons() []Person {
+	d.mu.RLock()
+	persons := make([]Person, 0, len(d.persons))
+	for _, person := range d.persons {
+		persons = append(persons, person)
+	}
+	d.mu.RUnlock()
+	sort.Slice(persons, func(i, j int) bool {
+		return persons[i].ID < persons[j].ID
+	})
+	return persons
+}
+
+// RfidPerson returns the person carrying the RFID tag with the EPC
+func (d *Directory) RfidPerson(epc string) (int, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	person, ok := d.rfid[normalizeEpc(epc)]
+	return person, ok
+}
+
+// WifiPerson returns the person owning the device with the MAC address
+func (d *Directory) WifiPerson(mac string) (int, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	person, ok := d.wifi[normalizeMac(mac)]
+	return person, ok
+}
+
+// CameraPerson returns the person with the camera re-identification label
+func (d *Directory) CameraPerson(label string) (int, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	person, ok := d.camera[normalizeLabel(label)]
+	return person, ok
+}
+
+// Watch starts reloading the directory in background when the file changes
+func (d *Directory) Watch() error {
+	watcher, err := files.Watch("Directory", []string{d.file}, reloadDelay, func([]string) {
+		err := d.Reload()
+		if err != nil {
+			log.Errorf("[Directory] %v", err.Error())
+		}
+	})
+	if err != nil {
+		return err
+	}
+	d.watcher = watcher
+	return nil
+}
+
+// Close stops watching the file
+func (d *Directory) Close() error {
+	if d.watcher == nil {
+		return nil
+	}
+	return d.watcher.Close()
+}
+
+// normalizeEpc removes the spaces of an EPC and writes it in upper case
+func normalizeEpc(epc string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(epc), ""))
+}
+
+// normalizeMac removes the separators of a MAC address and writes it in lower case
+func normalizeMac(mac string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", "-", "", ".", "", " ", "").Replace(mac))
+}
+
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.TrimSpace(label))
+}
+
+func readEntries(file string) (Entries, error) {
+	var entries Entries
+	byteData, err := ioutil.ReadFile(file)
+	if err != nil {
+		return entries, err
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		err = json.Unmarshal(byteData, &entries)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(byteData, &entries)
+	case ".csv":
+		entries, err = parseCSV(string(byteData))
+	default:
+		return entries, fmt.Errorf("unknown directory file format %s", filepath.Ext(file))
+	}
+	return entries, err
+}
+
+// parseCSV reads persons from a CSV with the header "id,name,groups,rfidtags,wifimacs,cameralabels",
+// where lists are separated by ";"
+func parseCSV(data string) (Entries, error) {
+	var entries Entries
+	table, err := files.ParseCSV(data, "id")
+	if err != nil {
+		return entries, err
+	}
+	field, list := table.Field, table.List
+
+	for line, record := range table.Records {
+		id, err := strconv.Atoi(field(record, "id"))
+		if err != nil {
+			return entries, fmt.Errorf("line %d: invalid id %s", line+2, field(record, "id"))
+		}
+		entries.Persons = append(entries.Persons, Person{
+			ID:           id,
+			Name:         field(record, "name"),
+			Groups:       list(record, "groups"),
+			RfidTags:     list(record, "rfidtags"),
+			WifiMacs:     list(record, "wifimacs"),
+			CameraLabels: list(record, "cameralabels"),
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,61 @@
+package files
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+// CSV has the rows of a CSV file with a header, read by the names of the columns. Lines starting
+// with # are comments
+type CSV struct {
+	// Records are the rows after the header. The row i is in the line i+2 of the file
+	Records [][]string
+	columns map[string]int
+}
+
+// ParseCSV reads a CSV with a header, which must have the required columns. The names of the
+// columns are case insensitive
+func ParseCSV(data string, required ...string) (*CSV, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	c := &CSV{columns: make(map[string]int)}
+	if len(records) == 0 {
+		return c, nil
+	}
+	for i, name := range records[0] {
+		c.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range required {
+		if _, ok := c.columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %s", name)
+		}
+	}
+	c.Records = records[1:]
+	return c, nil
+}
+
+// Field returns the value of a column in a row, empty when the column doesn't exist
+func (c *CSV) Field(record []string, name string) string {
+	if i, ok := c.columns[name]; ok && i < len(record) {
+		return strings.TrimSpace(record[i])
+	}
+	return ""
+}
+
+// List returns the values of a column separated by ";"
+func (c *CSV) List(record []string, name string) []string {
+	value := c.Field(record, name)
+	if value == "" {
+		return nil
+	}
+	var values []string
+	for _, v := range strings.Split(value, ";") {
+		values = append(values, strings.TrimSpace(v))
+	}
+	return values
+}
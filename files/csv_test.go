@@ -0,0 +1,33 @@
+package files
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	table, err := ParseCSV("# comment\nID, Name ,Groups\n1,Ana, staff ; admin\n2,Luis,\n", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table.Records) != 2 {
+		t.Fatalf("Records = %d, want 2", len(table.Records))
+	}
+	if name := table.Field(table.Records[0], "name"); name != "Ana" {
+		t.Errorf("Field(name) = %q, want Ana", name)
+	}
+	if groups := table.List(table.Records[0], "groups"); !reflect.DeepEqual(groups, []string{"staff", "admin"}) {
+		t.Errorf("List(groups) = %v, want [staff admin]", groups)
+	}
+	if groups := table.List(table.Records[1], "groups"); groups != nil {
+		t.Errorf("List(groups) = %v, want nil", groups)
+	}
+	if missing := table.Field(table.Records[0], "missing"); missing != "" {
+		t.Errorf("Field(missing) = %q, want empty", missing)
+	}
+
+	_, err = ParseCSV("name\nAna\n", "id")
+	if err == nil || err.Error() != "missing column id" {
+		t.Errorf("ParseCSV() error = %v, want missing column id", err)
+	}
+}
@@ -0,0 +1,108 @@
+package files
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// Watcher calls a function when the watched files change
+type Watcher struct {
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// Watch calls changed in background with the files written, created or renamed. The call waits
+// until no file changed during the delay, so a file written in several steps only triggers one call.
+// The directories of the files are watched, so that files replaced by a rename are still followed.
+// The tag is the prefix of the logs
+func Watch(tag string, files []string, delay time.Duration, changed func(files []string)) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		err = watcher.Add(dir)
+		if err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	w := &Watcher{watcher: watcher, done: make(chan struct{})}
+	go w.loop(tag, files, delay, changed)
+	return w, nil
+}
+
+// Close stops watching the files
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.watcher.Close()
+}
+
+func (w *Watcher) loop(tag string, files []string, delay time.Duration, changed func(files []string)) {
+	var timer <-chan time.Time
+	pending := make(map[string]bool)
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			file, ok := watchedFile(event.Name, files)
+			if !ok {
+				continue
+			}
+			log.Debugf("[%s] File event: %v", tag, event)
+			pending[file] = true
+			timer = time.After(delay)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("[%s] Watcher error: %v", tag, err.Error())
+		case <-timer:
+			var changedFiles []string
+			for _, file := range files {
+				if pending[file] {
+					changedFiles = append(changedFiles, file)
+				}
+			}
+			pending = make(map[string]bool)
+			changed(changedFiles)
+		}
+	}
+}
+
+// watchedFile returns the watched file with the name of an event
+func watchedFile(name string, files []string) (string, bool) {
+	for _, file := range files {
+		if SameFile(name, file) {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// SameFile returns if both names are the same file, even when one of them is relative
+func SameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
@@ -0,0 +1,64 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchDebouncesAndFollowsRenames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	watched := filepath.Join(dir, "watched.yaml")
+	other := filepath.Join(dir, "other.yaml")
+
+	calls := make(chan []string, 10)
+	watcher, err := Watch("Test", []string{watched}, 100*time.Millisecond, func(changed []string) {
+		calls <- changed
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	// Several writes and a rename over the file only trigger one call
+	for i := 0; i < 3; i++ {
+		err = ioutil.WriteFile(watched, []byte("a"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = ioutil.WriteFile(watched+".tmp", []byte("b"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Rename(watched+".tmp", watched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case changed := <-calls:
+		if !reflect.DeepEqual(changed, []string{watched}) {
+			t.Errorf("changed = %v, want %v", changed, []string{watched})
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No call after changing the file")
+	}
+
+	// Other files of the directory are ignored
+	err = ioutil.WriteFile(other, []byte("c"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case changed := <-calls:
+		t.Errorf("Unexpected call with %v", changed)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
@@ -3,9 +3,9 @@ module mainprocess
 go 1.14
 
 require (
-	github.com/cdipaolo/goml v0.0.0-20190412180403-e1f51f713598 // indirect
+	github.com/cdipaolo/goml v0.0.0-20190412180403-e1f51f713598
 	github.com/eclipse/paho.mqtt.golang v1.2.0
-	github.com/fsnotify/fsnotify v1.4.9 // indirect
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/ivangonzalezacuna/ml_regression_tracking v0.0.0-20200629141153-55ab1bc1b18c
 	github.com/mitchellh/mapstructure v1.3.2 // indirect
 	github.com/pelletier/go-toml v1.8.0 // indirect
@@ -15,8 +15,10 @@ require (
 	github.com/spf13/jwalterweatherman v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/spf13/viper v1.7.0
+	go.etcd.io/bbolt v1.3.5
 	golang.org/x/net v0.0.0-20200625001655-4c5254603344 // indirect
 	golang.org/x/sys v0.0.0-20200625212154-ddb9806d33ae // indirect
 	golang.org/x/text v0.3.3 // indirect
 	gopkg.in/ini.v1 v1.57.0 // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -0,0 +1,278 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Types of the metrics
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+type (
+	// Registry has the metrics of a process, written in the Prometheus text format
+	Registry struct {
+		mu      sync.Mutex
+		metrics []metric
+	}
+
+	metric interface {
+		write(w io.Writer)
+	}
+
+	// desc has the name, help and label names shared by every kind of metric
+	desc struct {
+		name   string
+		help   string
+		typ    string
+		labels []string
+	}
+
+	// Counter is a value that only increases, with a series for each combination of label values
+	Counter struct {
+		desc
+		mu     sync.Mutex
+		series map[string]*series
+	}
+
+	// Gauge is a value that can go up and down, with a series for each combination of label values
+	Gauge struct {
+		Counter
+	}
+
+	series struct {
+		labelValues []string
+		value       float64
+	}
+
+	// Histogram counts the observations in cumulative buckets, with a series for each combination of
+	// label values
+	Histogram struct {
+		desc
+		buckets []float64
+		mu      sync.Mutex
+		series  map[string]*histogramSeries
+	}
+
+	histogramSeries struct {
+		labelValues []string
+		counts      []uint64
+		sum         float64
+		count       uint64
+	}
+
+	// Sample is a value of a metric collected when the metrics are written
+	Sample struct {
+		LabelValues []string
+		Value       float64
+	}
+
+	// funcMetric gets its samples from a function when the metrics are written
+	funcMetric struct {
+		desc
+		collect func() []Sample
+	}
+)
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Counter registers a counter with the label names
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name, help, TypeCounter, labels}, series: make(map[string]*series)}
+	r.register(c)
+	return c
+}
+
+// Gauge registers a gauge with the label names
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{Counter{desc: desc{name, help, TypeGauge, labels}, series: make(map[string]*series)}}
+	r.register(g)
+	return g
+}
+
+// Histogram registers a histogram with the upper bounds of the buckets, in increasing order, and the label names
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{desc: desc{name, help, TypeHistogram, labels}, buckets: buckets, series: make(map[string]*histogramSeries)}
+	r.register(h)
+	return h
+}
+
+// Func registers a counter or a gauge whose samples are collected when the metrics are written
+func (r *Registry) Func(name, help, typ string, labels []string, collect func() []Sample) {
+	r.register(&funcMetric{desc: desc{name, help, typ, labels}, collect: collect})
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes every metric in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	buffered := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(buffered)
+	}
+	return buffered.Flush()
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the value to the series of the label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(labelValues).value += value
+}
+
+// Set sets the value of the series of the label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(labelValues).value = value
+}
+
+func (c *Counter) get(labelValues []string) *series {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := c.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		c.series[key] = s
+	}
+	return s
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mu.Lock()
+	samples := make([]Sample, 0, len(c.series))
+	for _, s := range c.series {
+		samples = append(samples, Sample{LabelValues: s.labelValues, Value: s.value})
+	}
+	c.mu.Unlock()
+	c.desc.write(w, samples)
+}
+
+// Observe adds a value to the series of the label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := strings.Join(labelValues, "\xff")
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.desc.header(w)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, key := range keys {
+		s := h.series[key]
+		bucketValues := append(append([]string(nil), s.labelValues...), "")
+		for i, bound := range h.buckets {
+			bucketValues[len(bucketValues)-1] = formatValue(bound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels(bucketLabels, bucketValues), s.counts[i])
+		}
+		bucketValues[len(bucketValues)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels(bucketLabels, bucketValues), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels(h.labels, s.labelValues), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels(h.labels, s.labelValues), s.count)
+	}
+}
+
+func (f *funcMetric) write(w io.Writer) {
+	f.desc.write(w, f.collect())
+}
+
+func (d desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.typ)
+}
+
+// write writes the header and the samples sorted by their label values
+func (d desc) write(w io.Writer, samples []Sample) {
+	d.header(w)
+	sort.Slice(samples, func(i, j int) bool {
+		return strings.Join(samples[i].LabelValues, "\xff") < strings.Join(samples[j].LabelValues, "\xff")
+	})
+	for _, sample := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", d.name, labels(d.labels, sample.LabelValues), formatValue(sample.Value))
+	}
+}
+
+// labels formats the label pairs of a series, empty without labels
+func labels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer("\\", `\\`, "\"", `\"`, "\n", `\n`)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, escape.Replace(value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
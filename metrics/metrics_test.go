@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	registry := NewRegistry()
+	messages := registry.Counter("test_messages_total", "Messages received.", "node", "sensor")
+	messages.Inc("AA", "rfid")
+	messages.Add(2, "AA", "camera")
+	messages.Inc("AA", "rfid")
+	gauge := registry.Gauge("test_open", "Open windows.")
+	gauge.Set(3)
+	gauge.Set(1)
+	histogram := registry.Histogram("test_duration_seconds", "Duration\nof the windows.", []float64{0.5, 1}, "node")
+	histogram.Observe(0.25, "AA")
+	histogram.Observe(0.75, "AA")
+	histogram.Observe(2, "AA")
+	registry.Func("test_info", "Version.", TypeGauge, []string{"version"}, func() []Sample {
+		return []Sample{{LabelValues: []string{`v"1`}, Value: math.Inf(1)}}
+	})
+
+	var output strings.Builder
+	err := registry.Write(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP test_messages_total Messages received.
+# TYPE test_messages_total counter
+test_messages_total{node="AA",sensor="camera"} 2
+test_messages_total{node="AA",sensor="rfid"} 2
+# HELP test_open Open windows.
+# TYPE test_open gauge
+test_open 1
+# HELP test_duration_seconds Duration\nof the windows.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{node="AA",le="0.5"} 1
+test_duration_seconds_bucket{node="AA",le="1"} 2
+test_duration_seconds_bucket{node="AA",le="+Inf"} 3
+test_duration_seconds_sum{node="AA"} 3
+test_duration_seconds_count{node="AA"} 3
+# HELP test_info Version.
+# TYPE test_info gauge
+test_info{version="v\"1"} +Inf
+`
+	if output.String() != expected {
+		t.Errorf("Metrics written:\n%s\nwant:\n%s", output.String(), expected)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	registry := NewRegistry()
+	registry.Counter("test_total", "Test.").Inc()
+	server := httptest.NewServer(registry.Handler())
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "text/plain; version=0.0.4") || !strings.Contains(string(body), "test_total 1\n") {
+		t.Errorf("GET returned %s with %q, want the metrics in the text format", response.Header.Get("Content-Type"), body)
+	}
+
+	response, err = http.Post(server.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST returned %d, want %d", response.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
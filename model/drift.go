@@ -0,0 +1,252 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Drift methods available to compare the live features with the train data
+const (
+	DriftPSI = "psi"
+	DriftKS  = "ks"
+)
+
+// psiEpsilon replaces empty bins, so the PSI doesn't become infinite
+const psiEpsilon = 0.0001
+
+type (
+	// Distribution stores the sorted values of each feature of the train data
+	Distribution struct {
+		features [][]float64
+	}
+
+	// DriftConfig defines how the live features are compared with the train data
+	DriftConfig struct {
+		// Method is one of DriftPSI or DriftKS
+		Method string
+		// Threshold is the distance from which a feature is considered drifted
+		Threshold float64
+		// Window is the number of last feature vectors kept for each node
+		Window int
+		// MinSamples is the number of feature vectors needed before comparing
+		MinSamples int
+		// Bins is the number of quantile bins used by the PSI
+		Bins int
+	}
+
+	// DriftWarning is generated when a feature of a node crosses the drift threshold
+	DriftWarning struct {
+		Node      string  `json:"node"`
+		Feature   string  `json:"feature"`
+		Method    string  `json:"method"`
+		Value     float64 `json:"value"`
+		Threshold float64 `json:"threshold"`
+		Drifted   bool    `json:"drifted"`
+		Timestamp string  `json:"timestamp"`
+	}
+
+	// DriftDetector keeps the last feature vectors of each node and compares them with the train data
+	DriftDetector struct {
+		config DriftConfig
+		names  []string
+
+		mu    sync.Mutex
+		nodes map[string]*nodeSamples
+	}
+
+	nodeSamples struct {
+		rows    [][]float64
+		next    int
+		drifted []bool
+	}
+)
+
+// NewDistribution creates the distribution of each feature of a dataset
+func NewDistribution(x [][]float64) *Distribution {
+	if len(x) == 0 {
+		return &Distribution{}
+	}
+	d := &Distribution{features: make([][]float64, len(x[0]))}
+	for j := range d.features {
+		values := make([]float64, 0, len(x))
+		for _, row := range x {
+			if j < len(row) {
+				values = append(values, row[j])
+			}
+		}
+		sort.Float64s(values)
+		d.features[j] = values
+	}
+	return d
+}
+
+// Size returns the number of features of the distribution
+func (d *Distribution) Size() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.features)
+}
+
+// PSI calculates the Population Stability Index of a sample of the feature j, using quantile
+// bins of the train data
+func (d *Distribution) PSI(j int, sample []float64, bins int) float64 {
+	reference := d.features[j]
+	if len(reference) == 0 || len(sample) == 0 {
+		return 0
+	}
+	if bins < 2 {
+		bins = 10
+	}
+
+	// Repeated edges are removed, so features with few distinct values still get valid bins
+	var edges []float64
+	for i := 1; i < bins; i++ {
+		edge := reference[i*len(reference)/bins]
+		if len(edges) == 0 || edge > edges[len(edges)-1] {
+			edges = append(edges, edge)
+		}
+	}
+
+	expected := histogram(reference, edges)
+	actual := histogram(sample, edges)
+	psi := 0.0
+	for i := range expected {
+		e := math.Max(expected[i], psiEpsilon)
+		a := math.Max(actual[i], psiEpsilon)
+		psi += (a - e) * math.Log(a/e)
+	}
+	return psi
+}
+
+// KS calculates the Kolmogorov-Smirnov distance between a sample of the feature j and the train data
+func (d *Distribution) KS(j int, sample []float64) float64 {
+	reference := d.features[j]
+	if len(reference) == 0 || len(sample) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, sample...)
+	sort.Float64s(sorted)
+
+	distance := 0.0
+	i, k := 0, 0
+	for i < len(reference) && k < len(sorted) {
+		v := math.Min(reference[i], sorted[k])
+		for i < len(reference) && reference[i] <= v {
+			i++
+		}
+		for k < len(sorted) && sorted[k] <= v {
+			k++
+		}
+		cdfReference := float64(i) / float64(len(reference))
+		cdfSample := float64(k) / float64(len(sorted))
+		distance = math.Max(distance, math.Abs(cdfReference-cdfSample))
+	}
+	return distance
+}
+
+// histogram returns the proportion of values in each bin defined by the edges
+func histogram(values []float64, edges []float64) []float64 {
+	counts := make([]float64, len(edges)+1)
+	for _, v := range values {
+		counts[sort.SearchFloat64s(edges, v)]++
+	}
+	for i := range counts {
+		counts[i] /= float64(len(values))
+	}
+	return counts
+}
+
+// NewDriftDetector creates a drift detector. The names are used to identify each feature in the warnings
+func NewDriftDetector(config DriftConfig, names []string) (*DriftDetector, error) {
+	switch config.Method {
+	case DriftPSI, DriftKS:
+	default:
+		return nil, fmt.Errorf("Unknown drift method %s", config.Method)
+	}
+	if config.Window <= 0 {
+		return nil, fmt.Errorf("Drift window must be positive")
+	}
+	if config.MinSamples <= 0 || config.MinSamples > config.Window {
+		config.MinSamples = config.Window
+	}
+	return &DriftDetector{
+		config: config,
+		names:  names,
+		nodes:  make(map[string]*nodeSamples),
+	}, nil
+}
+
+// Observe adds the feature vectors of a window of the node and compares the last vectors with
+// the reference distribution. A warning is returned for each feature that starts or stops drifting
+func (d *DriftDetector) Observe(node string, rows [][]float64, reference *Distribution) ([]DriftWarning, error) {
+	if reference.Size() == 0 {
+		return nil, fmt.Errorf("Can't check drift without a reference distribution")
+	}
+	for _, row := range rows {
+		if len(row) != reference.Size() {
+			return nil, fmt.Errorf("Drift reference has %d features but received %d", reference.Size(), len(row))
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	samples, ok := d.nodes[node]
+	if !ok || len(samples.drifted) != reference.Size() {
+		samples = &nodeSamples{drifted: make([]bool, reference.Size())}
+		d.nodes[node] = samples
+	}
+	for _, row := range rows {
+		if len(samples.rows) < d.config.Window {
+			samples.rows = append(samples.rows, row)
+		} else {
+			samples.rows[samples.next] = row
+		}
+		samples.next = (samples.next + 1) % d.config.Window
+	}
+	if len(samples.rows) < d.config.MinSamples {
+		return nil, nil
+	}
+
+	var warnings []DriftWarning
+	timestamp := time.Now().Format(time.RFC3339)
+	for j := 0; j < reference.Size(); j++ {
+		values := make([]float64, len(samples.rows))
+		for i, row := range samples.rows {
+			values[i] = row[j]
+		}
+
+		var value float64
+		if d.config.Method == DriftKS {
+			value = reference.KS(j, values)
+		} else {
+			value = reference.PSI(j, values, d.config.Bins)
+		}
+
+		drifted := value >= d.config.Threshold
+		if drifted == samples.drifted[j] {
+			continue
+		}
+		samples.drifted[j] = drifted
+		warnings = append(warnings, DriftWarning{
+			Node:      node,
+			Feature:   d.featureName(j),
+			Method:    d.config.Method,
+			Value:     value,
+			Threshold: d.config.Threshold,
+			Drifted:   drifted,
+			Timestamp: timestamp,
+		})
+	}
+	return warnings, nil
+}
+
+func (d *DriftDetector) featureName(j int) string {
+	if j < len(d.names) {
+		return d.names[j]
+	}
+	return fmt.Sprintf("feature_%d", j)
+}
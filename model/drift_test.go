@@ -0,0 +1,88 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistributionStatistics(t *testing.T) {
+	var train, same, shifted []float64
+	for i := 0; i < 100; i++ {
+		train = append(train, float64(i))
+		same = append(same, float64((i*7)%100))
+		shifted = append(shifted, float64(i+100))
+	}
+	x := make([][]float64, len(train))
+	for i, v := range train {
+		x[i] = []float64{v}
+	}
+	reference := NewDistribution(x)
+
+	if ks := reference.KS(0, same); ks > 1e-9 {
+		t.Errorf("KS of the same values = %v, want 0", ks)
+	}
+	if ks := reference.KS(0, shifted); math.Abs(ks-1) > 1e-9 {
+		t.Errorf("KS of disjoint values = %v, want 1", ks)
+	}
+	if psi := reference.PSI(0, same, 10); psi > 1e-9 {
+		t.Errorf("PSI of the same values = %v, want 0", psi)
+	}
+	if psi := reference.PSI(0, shifted, 10); psi < 0.25 {
+		t.Errorf("PSI of shifted values = %v, want drift", psi)
+	}
+}
+
+func TestDriftDetectorWarnings(t *testing.T) {
+	var train [][]float64
+	for i := 0; i < 100; i++ {
+		train = append(train, []float64{float64(i), 1})
+	}
+	reference := NewDistribution(train)
+	detector, err := NewDriftDetector(DriftConfig{Method: DriftKS, Threshold: 0.5, Window: 10, MinSamples: 5}, []string{"presence", "wifiuser"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	observe := func(value float64, n int) []DriftWarning {
+		var rows [][]float64
+		for i := 0; i < n; i++ {
+			rows = append(rows, []float64{value + float64(i*10), 1})
+		}
+		warnings, err := detector.Observe("AA", rows, reference)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return warnings
+	}
+
+	if warnings := observe(500, 4); len(warnings) != 0 {
+		t.Errorf("Warnings before the minimum samples: %v", warnings)
+	}
+	warnings := observe(500, 1)
+	if len(warnings) != 1 || warnings[0].Feature != "presence" || !warnings[0].Drifted || warnings[0].Node != "AA" {
+		t.Fatalf("Drift warnings = %+v, want presence drifted", warnings)
+	}
+	if warnings := observe(500, 1); len(warnings) != 0 {
+		t.Errorf("Repeated warnings of a drifted feature: %v", warnings)
+	}
+	warnings = observe(0, 10)
+	if len(warnings) != 1 || warnings[0].Drifted {
+		t.Errorf("Warnings = %+v, want presence back to the train distribution", warnings)
+	}
+
+	_, err = detector.Observe("AA", [][]float64{{1, 2, 3}}, reference)
+	if err == nil {
+		t.Error("Observed rows with more features than the train data")
+	}
+}
+
+func TestNewDriftDetectorErrors(t *testing.T) {
+	_, err := NewDriftDetector(DriftConfig{Method: "unknown", Window: 10}, nil)
+	if err == nil {
+		t.Error("Created a detector with an unknown method")
+	}
+	_, err = NewDriftDetector(DriftConfig{Method: DriftPSI}, nil)
+	if err == nil {
+		t.Error("Created a detector without window")
+	}
+}
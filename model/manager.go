@@ -0,0 +1,500 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"mainprocess/files"
+
+	"github.com/cdipaolo/goml/base"
+	log "github.com/sirupsen/logrus"
+)
+
+// reloadDelay is the time waited after the last file event before reloading, so that
+// a file written in several steps only triggers one reload
+const reloadDelay = 500 * time.Millisecond
+
+// Manager keeps the model used for the predictions and replaces it in background
+// when the train data or the model file change
+type Manager struct {
+	trainFile string
+	testFile  string
+	modelFile string
+	// Tolerance is the accuracy or recall loss allowed to a new model. A model losing more is
+	// rejected before replacing the current one, which keeps being used
+	Tolerance float64
+	// Preprocessing defines the preprocessor fitted on the train data
+	Preprocessing PreprocessConfig
+	// Features is the number of features of the data to predict. Models with another number of
+	// features are rejected, and 0 accepts any number
+	Features int
+	// Training has the settings of the models trained or restored. When they are searched, the
+	// settings found are kept for the next trainings
+	Training TrainConfig
+	// ReadOnly managers only load the model file. They never train a model from the train data,
+	// and they accept every new model file without comparing it with the current one, which is
+	// needed to evaluate candidate models
+	ReadOnly bool
+
+	mu       sync.RWMutex
+	current  *Model
+	previous *Model
+	base     *Model
+	version  int
+	// modelHash is the hash of the model files of the last model accepted, or saved by the manager
+	modelHash string
+	// baseReloaded is called after the files changed and the base model was replaced
+	baseReloaded func(base *Model)
+
+	reloadMu sync.Mutex
+	watcher  *files.Watcher
+}
+
+// modelFileData is the content of a model file. The first model files only had the parameters
+type modelFileData struct {
+	Theta            []float64 `json:"theta"`
+	DecisionBoundary float64   `json:"decisionboundary"`
+	Iterations       int       `json:"iterations"`
+}
+
+// NewManager creates a model manager. The modelFile is optional, when it is empty the
+// model is always trained from the train data
+func NewManager(trainFile, testFile, modelFile string) *Manager {
+	return &Manager{
+		trainFile: trainFile,
+		testFile:  testFile,
+		modelFile: modelFile,
+		Training:  TrainConfig{Iterations: -1, DecisionBoundary: -1},
+	}
+}
+
+// TrainSettings returns the training settings, including the ones found by the last search
+func (m *Manager) TrainSettings() TrainConfig {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	return m.Training
+}
+
+// Current returns the model to use for the next prediction. The returned model is never
+// modified, so it can be used during a whole window even if a new model is loaded
+func (m *Manager) Current() *Model {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// Load loads the model from the model file if it exists, or trains a new one otherwise
+func (m *Manager) Load() error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	var candidate *Model
+	var err error
+	if _, errStat := os.Stat(m.modelFile); m.modelFile != "" && errStat == nil {
+		candidate, err = m.restore()
+	} else if m.ReadOnly {
+		return fmt.Errorf("Model file %s doesn't exist", m.modelFile)
+	} else {
+		candidate, err = m.train()
+	}
+	if err != nil {
+		return err
+	}
+	err = m.checkFeatures(candidate)
+	if err != nil {
+		return err
+	}
+
+	xTest, yTest, err := base.LoadDataFromCSV(m.testFile)
+	if err != nil {
+		return err
+	}
+	candidate.Metrics, err = candidate.Evaluate(xTest, yTest)
+	if err != nil {
+		return err
+	}
+	if candidate.Source == m.trainFile {
+		err = m.persist(candidate)
+		if err != nil {
+			log.Errorf("[Model] Unable to persist model: %v", err.Error())
+		}
+	}
+	m.accept(candidate)
+	return nil
+}
+
+// Base returns the last model loaded from the train data or the model file, without the
+// updates done with Update
+func (m *Manager) Base() *Model {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.base
+}
+
+// Update replaces the current model with a new one using the received parameters. The new model
+// keeps the preprocessor, the decision boundary and the reference of the current model, and it's
+// rejected if it's worse than the base model on the test data
+func (m *Manager) Update(theta []float64, source string) (*Model, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	current := m.Current()
+	if current == nil {
+		return nil, fmt.Errorf("Can't update a nil Model")
+	}
+	if len(theta) != len(current.Theta()) {
+		return nil, fmt.Errorf("Model has %d parameters but received %d", len(current.Theta()), len(theta))
+	}
+	candidate := newFromTheta(theta, current.DecissionBoundary, current.Iterations)
+	candidate.Preprocessor = current.Preprocessor
+	candidate.Reference = current.Reference
+	candidate.Source = source
+
+	xTest, yTest, err := base.LoadDataFromCSV(m.testFile)
+	if err != nil {
+		return nil, err
+	}
+	candidate.Metrics, err = candidate.Evaluate(xTest, yTest)
+	if err != nil {
+		return nil, err
+	}
+	err = m.validate(candidate, m.Base(), xTest, yTest)
+	if err != nil {
+		return nil, err
+	}
+	m.swap(candidate, false)
+	return candidate, nil
+}
+
+// Rollback restores the model used before the last reload or update. The reloads don't need it,
+// because a model that regresses is rejected before replacing the current one
+func (m *Manager) Rollback() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.previous == nil {
+		return fmt.Errorf("There is no previous model to roll back to")
+	}
+	log.Warnf("[Model] Rolling back from model v%d to v%d", m.current.Version, m.previous.Version)
+	m.current, m.previous = m.previous, m.current
+	return nil
+}
+
+// Watch starts watching the train, test and model files in background
+func (m *Manager) Watch() error {
+	var watched []string
+	// ReadOnly managers never train, so the train and test data aren't watched
+	if !m.ReadOnly {
+		watched = append(watched, m.trainFile, m.testFile)
+	}
+	if m.modelFile != "" {
+		watched = append(watched, m.modelFile, PreprocessorFile(m.modelFile))
+	}
+	watcher, err := files.Watch("Model", watched, reloadDelay, m.filesChanged)
+	if err != nil {
+		return err
+	}
+	m.watcher = watcher
+	log.Infof("[Model] Watching %s for changes", strings.Join(watched, ", "))
+	return nil
+}
+
+// Close stops watching the files
+func (m *Manager) Close() error {
+	if m.watcher == nil {
+		return nil
+	}
+	return m.watcher.Close()
+}
+
+// filesChanged retrains the model when the train or test data changed, or restores it when only
+// the model file changed
+func (m *Manager) filesChanged(changed []string) {
+	retrain, restore := false, false
+	for _, file := range changed {
+		if file == m.trainFile || file == m.testFile {
+			retrain = true
+		} else {
+			restore = true
+		}
+	}
+	base := m.Base()
+	err := m.reload(retrain, restore)
+	if err != nil {
+		log.Errorf("[Model] Unable to reload model: %v", err.Error())
+	}
+	if current := m.Base(); current != base && m.baseReloaded != nil {
+		m.baseReloaded(current)
+	}
+}
+
+// reload builds a new model, validates it against the test data and swaps it with the
+// current one if its metrics don't regress
+func (m *Manager) reload(retrain, restore bool) error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	var candidate *Model
+	var err error
+	if restore && !retrain {
+		changed, errHash := m.modelFileChanged()
+		if errHash != nil {
+			return errHash
+		}
+		if !changed {
+			log.Debugf("[Model] Model file %s not changed, skipping reload", m.modelFile)
+			return nil
+		}
+		candidate, err = m.restore()
+	} else {
+		candidate, err = m.train()
+	}
+	if err != nil {
+		return err
+	}
+	err = m.checkFeatures(candidate)
+	if err != nil {
+		return err
+	}
+
+	xTest, yTest, err := base.LoadDataFromCSV(m.testFile)
+	if err != nil {
+		return err
+	}
+	candidate.Metrics, err = candidate.Evaluate(xTest, yTest)
+	if err != nil {
+		return err
+	}
+
+	if !m.ReadOnly {
+		err = m.validate(candidate, m.Current(), xTest, yTest)
+		if err != nil {
+			log.Warnf("[Model] %v", err.Error())
+			return nil
+		}
+	}
+
+	if candidate.Source == m.trainFile {
+		err = m.persist(candidate)
+		if err != nil {
+			log.Errorf("[Model] Unable to persist model: %v", err.Error())
+		}
+	}
+	m.accept(candidate)
+	return nil
+}
+
+// checkFeatures returns an error if the candidate doesn't predict from the number of features of the manager
+func (m *Manager) checkFeatures(candidate *Model) error {
+	if m.Features > 0 && candidate.Features() != m.Features {
+		return fmt.Errorf("Model from %s has %d features but the data to predict has %d, check the columns of %s and %s",
+			candidate.Source, candidate.Features(), m.Features, m.trainFile, m.testFile)
+	}
+	return nil
+}
+
+// validate returns an error if the candidate loses more accuracy or recall than the tolerance
+// compared with the reference model. The reference is evaluated again, since the test data could
+// have changed
+func (m *Manager) validate(candidate, reference *Model, xTest [][]float64, yTest []float64) error {
+	if reference == nil {
+		return nil
+	}
+	referenceMetrics, err := reference.Evaluate(xTest, yTest)
+	if err != nil {
+		return err
+	}
+	if candidate.Metrics.Accuracy+m.Tolerance < referenceMetrics.Accuracy ||
+		candidate.Metrics.Recall+m.Tolerance < referenceMetrics.Recall {
+		return fmt.Errorf("Rejected model from %s. Accuracy: %.4f (v%d %.4f), Recall: %.4f (v%d %.4f)",
+			candidate.Source, candidate.Metrics.Accuracy, reference.Version, referenceMetrics.Accuracy,
+			candidate.Metrics.Recall, reference.Version, referenceMetrics.Recall)
+	}
+	return nil
+}
+
+// accept replaces the current model with a model from the train data or the model file, and keeps
+// the hash of its model files so that they aren't reloaded again
+func (m *Manager) accept(candidate *Model) {
+	if candidate.Hash != "" {
+		m.modelHash = candidate.Hash
+	}
+	m.swap(candidate, true)
+}
+
+// swap replaces the current model. When isBase is true, the candidate also becomes the base model
+func (m *Manager) swap(candidate *Model, isBase bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.version++
+	candidate.Version = m.version
+	candidate.LoadedAt = time.Now()
+	m.previous = m.current
+	m.current = candidate
+	if isBase {
+		m.base = candidate
+	}
+	log.Infof("[Model] Loaded model v%d from %s. Accuracy: %.4f, Precision: %.4f, Recall: %.4f",
+		candidate.Version, candidate.Source, candidate.Metrics.Accuracy, candidate.Metrics.Precision, candidate.Metrics.Recall)
+}
+
+func (m *Manager) train() (*Model, error) {
+	xTrain, yTrain, err := base.LoadDataFromCSV(m.trainFile)
+	if err != nil {
+		return nil, err
+	}
+	xTest, yTest, err := base.LoadDataFromCSV(m.testFile)
+	if err != nil {
+		return nil, err
+	}
+
+	reference := NewDistribution(xTrain)
+	preprocessor, err := FitPreprocessor(xTrain, m.Preprocessing)
+	if err != nil {
+		return nil, err
+	}
+	xTrain, err = preprocessor.Transform(xTrain)
+	if err != nil {
+		return nil, err
+	}
+	xTest, err = preprocessor.Transform(xTest)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("[Model] Preprocessor: %#v", preprocessor)
+
+	if m.Training.searched() {
+		log.Infof("[Model] Looking for the best iterations and decision boundary...")
+	}
+	modelData, training, err := trainBestModel(xTrain, yTrain, xTest, yTest, m.Training)
+	if err != nil {
+		return nil, err
+	}
+	m.Training = training
+	log.Debugf("[Model] ModelData: %#v", modelData)
+	return &Model{ModelData: modelData, Preprocessor: preprocessor, Reference: reference, Source: m.trainFile}, nil
+}
+
+func (m *Manager) restore() (*Model, error) {
+	byteData, err := ioutil.ReadFile(m.modelFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := parseModelFile(byteData)
+	if err != nil {
+		return nil, err
+	}
+	// The first model files only have the parameters, so the decision boundary comes from the settings
+	if data.DecisionBoundary < 0 {
+		data.DecisionBoundary = m.Training.DecisionBoundary
+		if data.DecisionBoundary < 0 {
+			data.DecisionBoundary = 0.5
+		}
+		data.Iterations = m.Training.Iterations
+	}
+	theta := data.Theta
+	if len(theta) < 2 {
+		return nil, fmt.Errorf("Invalid model file %s", m.modelFile)
+	}
+	preprocessor, err := LoadPreprocessor(PreprocessorFile(m.modelFile))
+	if err != nil {
+		return nil, err
+	}
+	if preprocessor != nil && len(preprocessor.Features) != len(theta)-1 {
+		return nil, fmt.Errorf("Preprocessor of %s has %d features but the model has %d", m.modelFile, len(preprocessor.Features), len(theta)-1)
+	}
+	// The hash is only kept by the manager if the model is accepted, so a rejected model file is
+	// evaluated again when it changes
+	hash, err := m.filesHash()
+	if err != nil {
+		return nil, err
+	}
+
+	candidate := newFromTheta(theta, data.DecisionBoundary, data.Iterations)
+	candidate.Preprocessor = preprocessor
+	candidate.Source = m.modelFile
+	candidate.Hash = hash
+
+	xTrain, _, err := base.LoadDataFromCSV(m.trainFile)
+	if err != nil {
+		log.Warnf("[Model] Unable to load train data %s for the drift reference: %v", m.trainFile, err.Error())
+	} else {
+		candidate.Reference = NewDistribution(xTrain)
+	}
+	return candidate, nil
+}
+
+// persist writes the preprocessor, and the model parameters with their decision boundary to the
+// model file. The hash is kept so that the event generated by this write doesn't trigger a new reload
+func (m *Manager) persist(candidate *Model) error {
+	if m.modelFile == "" {
+		return nil
+	}
+	err := SavePreprocessor(candidate.Preprocessor, PreprocessorFile(m.modelFile))
+	if err != nil {
+		return err
+	}
+	byteData, err := json.Marshal(modelFileData{
+		Theta:            candidate.Theta(),
+		DecisionBoundary: candidate.DecissionBoundary,
+		Iterations:       candidate.Iterations,
+	})
+	if err != nil {
+		return err
+	}
+	tmpFile := m.modelFile + ".tmp"
+	err = ioutil.WriteFile(tmpFile, byteData, 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpFile, m.modelFile)
+	if err != nil {
+		return err
+	}
+	m.modelHash, err = m.filesHash()
+	if err != nil {
+		return err
+	}
+	candidate.Hash = m.modelHash
+	return nil
+}
+
+func (m *Manager) modelFileChanged() (bool, error) {
+	hash, err := m.filesHash()
+	if err != nil {
+		return false, err
+	}
+	return hash != m.modelHash, nil
+}
+
+// filesHash returns the hash of the model file together with its preprocessor file
+func (m *Manager) filesHash() (string, error) {
+	hash := sha256.New()
+	for _, file := range []string{m.modelFile, PreprocessorFile(m.modelFile)} {
+		byteData, err := ioutil.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		hash.Write(byteData)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// parseModelFile reads a model file with its decision boundary, or only the parameters of the first
+// model files, which return a negative decision boundary
+func parseModelFile(byteData []byte) (modelFileData, error) {
+	data := modelFileData{DecisionBoundary: -1, Iterations: -1}
+	err := json.Unmarshal(byteData, &data.Theta)
+	if err == nil {
+		return data, nil
+	}
+	data = modelFileData{}
+	err = json.Unmarshal(byteData, &data)
+	return data, err
+}
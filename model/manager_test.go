@@ -0,0 +1,120 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManagerPersistsDecisionBoundary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trainFile, testFile := writeDataset(t, dir)
+	modelFile := filepath.Join(dir, "model.json")
+
+	trained := NewManager(trainFile, testFile, modelFile)
+	trained.Training = TrainConfig{Iterations: 500, DecisionBoundary: 0.7}
+	err = trained.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The restored model uses the decision boundary of the model file, not the default settings
+	restored := NewManager(trainFile, testFile, modelFile)
+	err = restored.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := restored.Current(); current.DecissionBoundary != 0.7 || current.Iterations != 500 {
+		t.Errorf("Restored model has decision boundary %v and %d iterations, want 0.7 and 500", current.DecissionBoundary, current.Iterations)
+	}
+
+	// Model files with only the parameters take the decision boundary from the settings
+	err = ioutil.WriteFile(modelFile, []byte("[-1, 0.05, 0]"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := NewManager(trainFile, testFile, modelFile)
+	legacy.Training = TrainConfig{Iterations: 100, DecisionBoundary: 0.6}
+	err = legacy.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := legacy.Current(); current.DecissionBoundary != 0.6 || len(current.Theta()) != 3 {
+		t.Errorf("Model of a parameters file = %+v, want 3 parameters and decision boundary 0.6", current.ModelData)
+	}
+}
+
+func TestManagerRejectsWorseModelFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trainFile, testFile := writeDataset(t, dir)
+	modelFile := filepath.Join(dir, "model.json")
+
+	manager := NewManager(trainFile, testFile, modelFile)
+	manager.Training = TrainConfig{Iterations: 500, DecisionBoundary: 0.5}
+	manager.Tolerance = 0.02
+	err = manager.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := manager.Current()
+
+	// A model predicting every row as negative loses the whole recall
+	err = ioutil.WriteFile(modelFile, []byte(`{"theta": [-100, 0, 0], "decisionboundary": 0.5, "iterations": 500}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.reload(false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manager.Current() != current {
+		t.Fatalf("Worse model file replaced the current model: %+v", manager.Current().Metrics)
+	}
+	// The rejected file isn't taken as loaded, so it's evaluated again on the next change
+	changed, err := manager.modelFileChanged()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("Rejected model file taken as the loaded one")
+	}
+}
+
+func TestManagerRejectsOtherFeatureCount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manager")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trainFile, testFile := writeDataset(t, dir)
+
+	manager := NewManager(trainFile, testFile, "")
+	manager.Training = TrainConfig{Iterations: 100, DecisionBoundary: 0.5}
+	manager.Features = 3
+	if err := manager.Load(); err == nil {
+		t.Fatal("Loaded a model of 2 features for data of 3 features")
+	}
+
+	manager.Features = 2
+	err = manager.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := manager.Current()
+	err = ioutil.WriteFile(trainFile, []byte("1,2,3,1\n3,2,1,0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.reload(true, false); err == nil || manager.Current() != current {
+		t.Errorf("Reload of train data with 3 features = %v, want it rejected", err)
+	}
+}
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cdipaolo/goml/base"
+	"github.com/cdipaolo/goml/linear"
+	ml "github.com/ivangonzalezacuna/ml_regression_tracking"
+)
+
+type (
+	// Metrics has the evaluation results of a model against the test dataset
+	Metrics struct {
+		Positive      int     `json:"positive"`
+		Negative      int     `json:"negative"`
+		TruePositive  int     `json:"truepositive"`
+		TrueNegative  int     `json:"truenegative"`
+		FalsePositive int     `json:"falsepositive"`
+		FalseNegative int     `json:"falsenegative"`
+		Accuracy      float64 `json:"accuracy"`
+		Precision     float64 `json:"precision"`
+		Recall        float64 `json:"recall"`
+	}
+
+	// Model is a trained Logistic Regression Model together with the info needed to track it
+	Model struct {
+		ml.ModelData
+		// Preprocessor is applied to the features before the model. Nil when the model uses raw features
+		Preprocessor *Preprocessor
+		// Reference is the distribution of the raw train data, used to detect drift in the live features
+		Reference *Distribution
+		Version   int
+		Source    string
+		// Hash identifies the model file and preprocessor the model was loaded from or saved to. Empty
+		// when the model isn't stored in a file
+		Hash     string
+		LoadedAt time.Time
+		Metrics  Metrics
+	}
+)
+
+// Predict makes a prediction for each row of the received data
+func (m *Model) Predict(data [][]float64) ([]int, error) {
+	if m == nil {
+		return nil, fmt.Errorf("Can't make a prediction without a loaded model")
+	}
+	data, err := m.Preprocessor.Transform(data)
+	if err != nil {
+		return nil, err
+	}
+	return m.MakePrediction(data)
+}
+
+// Theta returns a copy of the parameter vector of the model
+func (m *Model) Theta() []float64 {
+	if m == nil || m.Model == nil {
+		return nil
+	}
+	theta := make([]float64, len(m.Model.Theta()))
+	copy(theta, m.Model.Theta())
+	return theta
+}
+
+// Features returns the number of features the model predicts from
+func (m *Model) Features() int {
+	if m == nil || m.Model == nil {
+		return 0
+	}
+	return len(m.Model.Theta()) - 1
+}
+
+// Evaluate calculates the metrics of the model against a labeled dataset
+func (m *Model) Evaluate(x [][]float64, y []float64) (Metrics, error) {
+	var metrics Metrics
+	if m == nil || m.Model == nil {
+		return metrics, fmt.Errorf("Can't evaluate a nil Model")
+	}
+	if len(x) != len(y) {
+		return metrics, fmt.Errorf("Evaluation dataset sizes mismatch")
+	}
+	x, err := m.Preprocessor.Transform(x)
+	if err != nil {
+		return metrics, err
+	}
+
+	for i := range x {
+		prediction, err := m.Model.Predict(x[i])
+		if err != nil {
+			return metrics, err
+		}
+		positive := prediction[0] >= m.DecissionBoundary
+		switch {
+		case y[i] == 1 && positive:
+			metrics.TruePositive++
+		case y[i] == 1 && !positive:
+			metrics.FalseNegative++
+		case y[i] == 0 && positive:
+			metrics.FalsePositive++
+		default:
+			metrics.TrueNegative++
+		}
+		if y[i] == 1 {
+			metrics.Positive++
+		} else {
+			metrics.Negative++
+		}
+	}
+
+	if metrics.Positive > 0 {
+		metrics.Recall = float64(metrics.TruePositive) / float64(metrics.Positive)
+	}
+	if metrics.TruePositive+metrics.FalsePositive > 0 {
+		metrics.Precision = float64(metrics.TruePositive) / float64(metrics.TruePositive+metrics.FalsePositive)
+	}
+	if len(y) > 0 {
+		metrics.Accuracy = float64(metrics.TruePositive+metrics.TrueNegative) / float64(len(y))
+	}
+	return metrics, nil
+}
+
+// newFromTheta creates a model from an already trained parameter vector
+func newFromTheta(theta []float64, decisionBoundary float64, iterations int) *Model {
+	logistic := linear.NewLogistic(base.BatchGA, 0.0001, 0.0, iterations, nil, nil, len(theta)-1)
+	copy(logistic.Parameters, theta)
+	return &Model{
+		ModelData: ml.ModelData{
+			Model:             logistic,
+			DecissionBoundary: decisionBoundary,
+			Iterations:        iterations,
+		},
+	}
+}
@@ -0,0 +1,292 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// OnlineConfig defines how the model is updated with the feedback of the operators
+	OnlineConfig struct {
+		// LearningRate is the step of each SGD iteration
+		LearningRate float64
+		// MaxStep is the maximum L2 distance that a single feedback can move the parameters
+		MaxStep float64
+		// MaxDistance is the maximum L2 distance between the updated and the base parameters
+		MaxDistance float64
+		// Windows is the number of last windows kept to receive feedback
+		Windows int
+		// WeightsFile is where the updated parameters are persisted. Empty to not persist them
+		WeightsFile string
+	}
+
+	// Feedback is the confirmation or rejection of the detections of a window
+	Feedback struct {
+		Window string `json:"window"`
+		// Person limits the feedback to the row of that person. Nil applies it to the whole window
+		Person *int `json:"person,omitempty"`
+		Label  int  `json:"label"`
+		// Revert discards every update and restores the base model
+		Revert bool `json:"revert,omitempty"`
+	}
+
+	// OnlineLearner updates the model incrementally with SGD steps from the feedback received
+	// for the last windows
+	OnlineLearner struct {
+		manager *Manager
+		config  OnlineConfig
+
+		mu      sync.Mutex
+		windows map[string]windowRows
+		order   []string
+		// updateMu serializes the updates, so that two feedbacks don't start from the same parameters
+		updateMu sync.Mutex
+		// updated is true while the current model has updates of the feedback
+		updated bool
+	}
+
+	windowRows struct {
+		persons []int
+		rows    [][]float64
+	}
+
+	onlineWeights struct {
+		Base  []float64 `json:"base"`
+		Theta []float64 `json:"theta"`
+	}
+)
+
+// NewOnlineLearner creates an online learner. If the weights file was updated from the current
+// base model, those weights are loaded in the manager. When the manager reloads the base model, the
+// updates are discarded
+func NewOnlineLearner(manager *Manager, config OnlineConfig) (*OnlineLearner, error) {
+	if config.Windows <= 0 {
+		return nil, fmt.Errorf("Number of feedback windows must be positive")
+	}
+	o := &OnlineLearner{
+		manager: manager,
+		config:  config,
+		windows: make(map[string]windowRows),
+	}
+	if manager != nil {
+		manager.baseReloaded = o.baseReloaded
+	}
+
+	if config.WeightsFile == "" {
+		return o, nil
+	}
+	byteData, err := ioutil.ReadFile(config.WeightsFile)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var weights onlineWeights
+	err = json.Unmarshal(byteData, &weights)
+	if err != nil {
+		return nil, err
+	}
+	if !equalTheta(weights.Base, manager.Base().Theta()) {
+		log.Warnf("[Online] Weights in %s were updated from another base model, ignoring them", config.WeightsFile)
+		return o, nil
+	}
+	updated, err := manager.Update(weights.Theta, config.WeightsFile)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("[Online] Loaded updated weights from %s as model v%d", config.WeightsFile, updated.Version)
+	o.updated = true
+	return o, nil
+}
+
+// Remember keeps the feature rows of a window, so feedback can be applied to them later
+func (o *OnlineLearner) Remember(window string, persons []int, rows [][]float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.windows[window]; !ok {
+		o.order = append(o.order, window)
+	}
+	o.windows[window] = windowRows{persons: persons, rows: rows}
+	for len(o.order) > o.config.Windows {
+		delete(o.windows, o.order[0])
+		o.order = o.order[1:]
+	}
+}
+
+// Apply updates the model with the feedback of a window
+func (o *OnlineLearner) Apply(feedback Feedback) error {
+	if feedback.Revert {
+		return o.Revert()
+	}
+	if feedback.Label != 0 && feedback.Label != 1 {
+		return fmt.Errorf("Invalid feedback label %d", feedback.Label)
+	}
+	o.updateMu.Lock()
+	defer o.updateMu.Unlock()
+
+	o.mu.Lock()
+	window, ok := o.windows[feedback.Window]
+	o.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("Window %s not found", feedback.Window)
+	}
+
+	var rows [][]float64
+	for i, row := range window.rows {
+		if feedback.Person == nil || window.persons[i] == *feedback.Person {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 && feedback.Person != nil {
+		return fmt.Errorf("Person %d not found in window %s", *feedback.Person, feedback.Window)
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("Window %s has no rows", feedback.Window)
+	}
+
+	current := o.manager.Current()
+	base := o.manager.Base()
+	if current == nil || base == nil {
+		return fmt.Errorf("Can't apply feedback without a loaded model")
+	}
+	rows, err := current.Preprocessor.Transform(rows)
+	if err != nil {
+		return err
+	}
+
+	theta := current.Theta()
+	step := make([]float64, len(theta))
+	for _, row := range rows {
+		if len(row)+1 != len(theta) {
+			return fmt.Errorf("Model has %d features but received %d", len(theta)-1, len(row))
+		}
+		// Gradient ascent over the log likelihood, the same direction used to train the model
+		z := theta[0]
+		for j, v := range row {
+			z += theta[j+1] * v
+		}
+		e := float64(feedback.Label) - 1/(1+math.Exp(-z))
+		step[0] += o.config.LearningRate * e
+		for j, v := range row {
+			step[j+1] += o.config.LearningRate * e * v
+		}
+	}
+
+	scaleToNorm(step, o.config.MaxStep)
+	for j := range theta {
+		theta[j] += step[j]
+	}
+	baseTheta := base.Theta()
+	distance := make([]float64, len(theta))
+	for j := range theta {
+		distance[j] = theta[j] - baseTheta[j]
+	}
+	if scaleToNorm(distance, o.config.MaxDistance) {
+		log.Warnf("[Online] Update of window %s limited to a distance of %v from the base model", feedback.Window, o.config.MaxDistance)
+		for j := range theta {
+			theta[j] = baseTheta[j] + distance[j]
+		}
+	}
+
+	updated, err := o.manager.Update(theta, "online")
+	if err != nil {
+		return err
+	}
+	o.updated = true
+	log.Infof("[Online] Applied feedback of window %s (label %d, %d rows) as model v%d. Accuracy: %.4f",
+		feedback.Window, feedback.Label, len(rows), updated.Version, updated.Metrics.Accuracy)
+	return o.save(baseTheta, theta)
+}
+
+// Revert discards every online update and restores the parameters of the base model
+func (o *OnlineLearner) Revert() error {
+	o.updateMu.Lock()
+	defer o.updateMu.Unlock()
+	base := o.manager.Base()
+	if base == nil {
+		return fmt.Errorf("There is no base model to revert to")
+	}
+	updated, err := o.manager.Update(base.Theta(), base.Source)
+	if err != nil {
+		return err
+	}
+	log.Infof("[Online] Reverted to the base model as model v%d", updated.Version)
+	o.updated = false
+	return o.removeWeights()
+}
+
+// baseReloaded discards the updates when the manager reloads the base model, because they were
+// computed for the parameters of the previous one
+func (o *OnlineLearner) baseReloaded(base *Model) {
+	o.updateMu.Lock()
+	defer o.updateMu.Unlock()
+	if !o.updated {
+		return
+	}
+	o.updated = false
+	log.Warnf("[Online] Base model reloaded from %s, discarding the updates of the feedback", base.Source)
+	err := o.removeWeights()
+	if err != nil {
+		log.Errorf("[Online] Unable to remove the weights file: %v", err.Error())
+	}
+}
+
+func (o *OnlineLearner) removeWeights() error {
+	if o.config.WeightsFile == "" {
+		return nil
+	}
+	err := os.Remove(o.config.WeightsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (o *OnlineLearner) save(baseTheta, theta []float64) error {
+	if o.config.WeightsFile == "" {
+		return nil
+	}
+	byteData, err := json.Marshal(onlineWeights{Base: baseTheta, Theta: theta})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(o.config.WeightsFile, byteData, 0644)
+}
+
+// scaleToNorm scales the vector so its L2 norm isn't greater than max. Returns true if it was scaled
+func scaleToNorm(v []float64, max float64) bool {
+	if max <= 0 {
+		return false
+	}
+	norm := 0.0
+	for _, x := range v {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+	if norm <= max {
+		return false
+	}
+	for j := range v {
+		v[j] *= max / norm
+	}
+	return true
+}
+
+func equalTheta(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
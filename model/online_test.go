@@ -0,0 +1,99 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyWithoutRows(t *testing.T) {
+	online, err := NewOnlineLearner(nil, OnlineConfig{Windows: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	online.Remember("empty", nil, nil)
+	online.Remember("window", []int{1}, [][]float64{{1, 2}})
+	person := 2
+
+	tests := []struct {
+		name     string
+		feedback Feedback
+		err      string
+	}{
+		{"empty window without person", Feedback{Window: "empty", Label: 1}, "Window empty has no rows"},
+		{"empty window with person", Feedback{Window: "empty", Person: &person, Label: 1}, "Person 2 not found in window empty"},
+		{"unknown person", Feedback{Window: "window", Person: &person, Label: 0}, "Person 2 not found in window window"},
+		{"unknown window", Feedback{Window: "missing", Label: 0}, "Window missing not found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := online.Apply(test.feedback)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Apply() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestOnlineLearnerWithManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "online")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trainFile, testFile := writeDataset(t, dir)
+	manager := NewManager(trainFile, testFile, filepath.Join(dir, "model.json"))
+	manager.Training = TrainConfig{Iterations: 500, DecisionBoundary: 0.5}
+	manager.Tolerance = 0.02
+	err = manager.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	weightsFile := filepath.Join(dir, "model.online.json")
+	online, err := NewOnlineLearner(manager, OnlineConfig{LearningRate: 0.0001, MaxStep: 0.01, MaxDistance: 0.1, Windows: 10, WeightsFile: weightsFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	online.Remember("window", []int{1, 2}, [][]float64{{90, 5}, {10, 5}})
+	person := 1
+	err = online.Apply(Feedback{Window: "window", Person: &person, Label: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current := manager.Current(); current.Source != "online" || current == manager.Base() {
+		t.Fatalf("Model after the feedback = v%d from %s, want an online update", current.Version, current.Source)
+	}
+	if _, err := os.Stat(weightsFile); err != nil {
+		t.Fatalf("Updated weights not saved: %v", err)
+	}
+
+	// A new base model discards the updates, which belong to the previous parameters
+	manager.filesChanged([]string{trainFile})
+	if manager.Current() != manager.Base() || manager.Current().Source != trainFile {
+		t.Errorf("Model after reloading the base = v%d from %s, want the new base model", manager.Current().Version, manager.Current().Source)
+	}
+	if _, err := os.Stat(weightsFile); !os.IsNotExist(err) {
+		t.Errorf("Weights of the previous base model kept: %v", err)
+	}
+
+	// An update that loses the recall on the test data is rejected
+	harmful, err := NewOnlineLearner(manager, OnlineConfig{LearningRate: 1, MaxStep: 100, MaxDistance: 100, Windows: 10, WeightsFile: weightsFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	harmful.Remember("window", []int{1}, [][]float64{{90, 5}})
+	current := manager.Current()
+	err = harmful.Apply(Feedback{Window: "window", Label: 0})
+	if err == nil || !strings.Contains(err.Error(), "Rejected model from online") {
+		t.Errorf("Apply() of a harmful feedback error = %v, want the update rejected", err)
+	}
+	if manager.Current() != current {
+		t.Error("Harmful update replaced the current model")
+	}
+	if _, err := os.Stat(weightsFile); !os.IsNotExist(err) {
+		t.Errorf("Weights of a rejected update saved: %v", err)
+	}
+}
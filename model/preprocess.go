@@ -0,0 +1,192 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Scaling methods available for the features
+const (
+	ScalingNone     = "none"
+	ScalingStandard = "standard"
+	ScalingMinMax   = "minmax"
+)
+
+type (
+	// PreprocessConfig defines how the Preprocessor is fitted
+	PreprocessConfig struct {
+		// Scaling is one of ScalingNone, ScalingStandard or ScalingMinMax
+		Scaling string
+		// Clip limits each feature to the range seen in the train data
+		Clip bool
+		// LogFeatures are the indexes of the features transformed with a logarithm before scaling
+		LogFeatures []int
+	}
+
+	// FeatureScaler has the transformation fitted for a single feature
+	FeatureScaler struct {
+		Scaling string  `json:"scaling"`
+		Clip    bool    `json:"clip"`
+		Log     bool    `json:"log"`
+		Min     float64 `json:"min"`
+		Max     float64 `json:"max"`
+		Mean    float64 `json:"mean"`
+		Std     float64 `json:"std"`
+	}
+
+	// Preprocessor transforms the raw features before they reach the model. It's fitted on
+	// the train data and applied in the same way to the data to predict
+	Preprocessor struct {
+		Features []FeatureScaler `json:"features"`
+	}
+)
+
+// FitPreprocessor calculates the preprocessing parameters of each feature from the train data
+func FitPreprocessor(x [][]float64, config PreprocessConfig) (*Preprocessor, error) {
+	if len(x) == 0 {
+		return nil, fmt.Errorf("Can't fit preprocessor with empty dataset")
+	}
+	switch config.Scaling {
+	case ScalingNone, ScalingStandard, ScalingMinMax:
+	case "":
+		config.Scaling = ScalingNone
+	default:
+		return nil, fmt.Errorf("Unknown scaling method %s", config.Scaling)
+	}
+
+	size := len(x[0])
+	p := &Preprocessor{Features: make([]FeatureScaler, size)}
+	for j := range p.Features {
+		p.Features[j] = FeatureScaler{
+			Scaling: config.Scaling,
+			Clip:    config.Clip,
+			Min:     math.Inf(1),
+			Max:     math.Inf(-1),
+		}
+	}
+	for _, j := range config.LogFeatures {
+		if j < 0 || j >= size {
+			return nil, fmt.Errorf("Log feature %d out of range", j)
+		}
+		p.Features[j].Log = true
+	}
+
+	for _, row := range x {
+		if len(row) != size {
+			return nil, fmt.Errorf("Train dataset size mismatch")
+		}
+		for j, v := range row {
+			p.Features[j].Min = math.Min(p.Features[j].Min, v)
+			p.Features[j].Max = math.Max(p.Features[j].Max, v)
+		}
+	}
+
+	// Mean and deviation are calculated after the log transformation, since scaling is applied over it
+	for j := range p.Features {
+		f := &p.Features[j]
+		var sum, sumSq float64
+		for _, row := range x {
+			v := f.logValue(row[j])
+			sum += v
+			sumSq += v * v
+		}
+		n := float64(len(x))
+		f.Mean = sum / n
+		f.Std = math.Sqrt(math.Max(sumSq/n-f.Mean*f.Mean, 0))
+	}
+	return p, nil
+}
+
+// Transform applies the preprocessing to each row. The received data isn't modified
+func (p *Preprocessor) Transform(x [][]float64) ([][]float64, error) {
+	if p == nil {
+		return x, nil
+	}
+	result := make([][]float64, len(x))
+	for i, row := range x {
+		if len(row) != len(p.Features) {
+			return nil, fmt.Errorf("Preprocessor expects %d features but received %d", len(p.Features), len(row))
+		}
+		result[i] = make([]float64, len(row))
+		for j, v := range row {
+			result[i][j] = p.Features[j].transform(v)
+		}
+	}
+	return result, nil
+}
+
+func (f *FeatureScaler) transform(v float64) float64 {
+	if f.Clip {
+		v = math.Max(f.Min, math.Min(f.Max, v))
+	}
+	v = f.logValue(v)
+
+	switch f.Scaling {
+	case ScalingStandard:
+		if f.Std == 0 {
+			return 0
+		}
+		return (v - f.Mean) / f.Std
+	case ScalingMinMax:
+		min, max := f.logValue(f.Min), f.logValue(f.Max)
+		if max == min {
+			return 0
+		}
+		return (v - min) / (max - min)
+	}
+	return v
+}
+
+// logValue shifts the value by the minimum of the train data, so that negative features
+// like the RSSI or the RFID power can also be transformed
+func (f *FeatureScaler) logValue(v float64) float64 {
+	if !f.Log {
+		return v
+	}
+	return math.Log1p(math.Max(v-f.Min, 0))
+}
+
+// SavePreprocessor writes the preprocessor to a JSON file
+func SavePreprocessor(p *Preprocessor, file string) error {
+	if p == nil {
+		err := os.Remove(file)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	byteData, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, byteData, 0644)
+}
+
+// LoadPreprocessor reads a preprocessor from a JSON file. If the file doesn't exist, a nil
+// preprocessor is returned, so the features are used without any change
+func LoadPreprocessor(file string) (*Preprocessor, error) {
+	byteData, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p Preprocessor
+	err = json.Unmarshal(byteData, &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PreprocessorFile returns the file where the preprocessor of a model file is stored
+func PreprocessorFile(modelFile string) string {
+	ext := filepath.Ext(modelFile)
+	return strings.TrimSuffix(modelFile, ext) + ".preprocess" + ext
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDataset writes a train and a test CSV with two features, where the label is 1 when the
+// first feature is high
+func writeDataset(t *testing.T, dir string) (string, string) {
+	var data strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&data, "%d,%d,1\n", 60+i, i%10)
+		fmt.Fprintf(&data, "%d,%d,0\n", i, i%10)
+	}
+	trainFile, testFile := filepath.Join(dir, "train.csv"), filepath.Join(dir, "test.csv")
+	for _, file := range []string{trainFile, testFile} {
+		err := ioutil.WriteFile(file, []byte(data.String()), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return trainFile, testFile
+}
+
+func TestPreprocessorTransform(t *testing.T) {
+	x := [][]float64{{0, -100}, {5, -60}, {10, -20}}
+	tests := []struct {
+		name   string
+		config PreprocessConfig
+		value  []float64
+		want   []float64
+	}{
+		{"none", PreprocessConfig{}, []float64{5, -60}, []float64{5, -60}},
+		{"minmax", PreprocessConfig{Scaling: ScalingMinMax}, []float64{5, -60}, []float64{0.5, 0.5}},
+		{"standard", PreprocessConfig{Scaling: ScalingStandard}, []float64{5, -60}, []float64{0, 0}},
+		{"clip", PreprocessConfig{Scaling: ScalingMinMax, Clip: true}, []float64{20, -200}, []float64{1, 0}},
+		{"log", PreprocessConfig{LogFeatures: []int{1}}, []float64{5, -100 + math.E - 1}, []float64{5, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := FitPreprocessor(x, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := p.Transform([][]float64{test.value})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j := range test.want {
+				if math.Abs(result[0][j]-test.want[j]) > 1e-9 {
+					t.Errorf("Feature %d = %v, want %v", j, result[0][j], test.want[j])
+				}
+			}
+		})
+	}
+}
+
+func TestPreprocessorErrors(t *testing.T) {
+	_, err := FitPreprocessor([][]float64{{1, 2}}, PreprocessConfig{Scaling: "unknown"})
+	if err == nil {
+		t.Error("Fitted an unknown scaling")
+	}
+	_, err = FitPreprocessor([][]float64{{1, 2}}, PreprocessConfig{LogFeatures: []int{2}})
+	if err == nil {
+		t.Error("Fitted a log feature out of range")
+	}
+	p, err := FitPreprocessor([][]float64{{1, 2}}, PreprocessConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Transform([][]float64{{1, 2, 3}})
+	if err == nil {
+		t.Error("Transformed a row with more features")
+	}
+}
+
+func TestManagerPersistsPreprocessor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trainFile, testFile := writeDataset(t, dir)
+	modelFile := filepath.Join(dir, "model.json")
+
+	trained := NewManager(trainFile, testFile, modelFile)
+	trained.Preprocessing = PreprocessConfig{Scaling: ScalingMinMax}
+	trained.Training = TrainConfig{Iterations: 500, DecisionBoundary: 0.5}
+	err = trained.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(PreprocessorFile(modelFile)); err != nil {
+		t.Fatalf("Preprocessor not saved next to the model: %v", err)
+	}
+
+	restored := NewManager(trainFile, testFile, modelFile)
+	restored.Training = trained.Training
+	err = restored.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Current().Source != modelFile {
+		t.Fatalf("Model loaded from %s, want %s", restored.Current().Source, modelFile)
+	}
+	row := [][]float64{{90, 5}, {10, 5}}
+	want, err := trained.Current().Predict(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := restored.Current().Predict(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Restored prediction %d = %d, want %d", i, got[i], want[i])
+		}
+	}
+
+	// A preprocessor with a different number of features doesn't belong to the model
+	err = SavePreprocessor(&Preprocessor{Features: make([]FeatureScaler, 3)}, PreprocessorFile(modelFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewManager(trainFile, testFile, modelFile).Load()
+	if err == nil {
+		t.Error("Loaded a model with a mismatched preprocessor")
+	}
+}
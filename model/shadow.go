@@ -0,0 +1,219 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// ShadowCount counts the rows where the production and the shadow models agree or disagree
+	ShadowCount struct {
+		Rows          int `json:"rows"`
+		Agreements    int `json:"agreements"`
+		Disagreements int `json:"disagreements"`
+		// ShadowPositives are the disagreements where only the shadow model detected a person
+		ShadowPositives int `json:"shadowpositives"`
+	}
+
+	// ShadowStats has the comparison between the production and the shadow models
+	ShadowStats struct {
+		ShadowCount
+		Windows           int    `json:"windows"`
+		ProductionVersion int    `json:"productionversion"`
+		ShadowSource      string `json:"shadowsource"`
+		ShadowVersion     int    `json:"shadowversion"`
+		// ShadowHash identifies the files of the shadow model, the counts are reset when it changes
+		ShadowHash string                  `json:"shadowhash"`
+		UpdatedAt  string                  `json:"updatedat"`
+		Nodes      map[string]*ShadowCount `json:"nodes"`
+	}
+
+	// Shadow scores every window with a candidate model whose predictions are only compared
+	// with the production model, so the candidate can be evaluated before promoting it
+	Shadow struct {
+		manager   *Manager
+		statsFile string
+		names     []string
+
+		mu    sync.Mutex
+		stats ShadowStats
+	}
+)
+
+// NewShadow creates a shadow evaluation of the model of the manager. The stats are stored in the
+// statsFile after every window, and the names are used to log the features of the disagreements
+func NewShadow(manager *Manager, statsFile string, names []string) *Shadow {
+	s := &Shadow{
+		manager:   manager,
+		statsFile: statsFile,
+		names:     names,
+		stats:     ShadowStats{Nodes: make(map[string]*ShadowCount)},
+	}
+	stats, err := LoadShadowStats(statsFile)
+	if err == nil && stats.Nodes != nil {
+		s.stats = stats
+	}
+	return s
+}
+
+// Compare scores the rows of a window with the shadow model and counts the disagreements with the
+// prediction of the production model
+func (s *Shadow) Compare(node string, rows [][]float64, production []int, productionVersion int) error {
+	shadowModel := s.manager.Current()
+	if shadowModel == nil {
+		return fmt.Errorf("Shadow model not loaded")
+	}
+	prediction, err := shadowModel.Predict(rows)
+	if err != nil {
+		return err
+	}
+	if len(prediction) != len(production) {
+		return fmt.Errorf("Shadow prediction results sizes mismatch")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats.ShadowHash != shadowModel.Hash {
+		if s.stats.Windows > 0 {
+			log.Infof("[Shadow] Shadow model changed, resetting the stats of %d windows", s.stats.Windows)
+		}
+		s.stats = ShadowStats{Nodes: make(map[string]*ShadowCount), ShadowHash: shadowModel.Hash}
+	}
+	if s.stats.ShadowSource != shadowModel.Source || s.stats.ShadowVersion != shadowModel.Version {
+		log.Infof("[Shadow] Evaluating model v%d from %s (%s)", shadowModel.Version, shadowModel.Source, shortHash(shadowModel.Hash))
+	}
+	nodeCount, ok := s.stats.Nodes[node]
+	if !ok {
+		nodeCount = &ShadowCount{}
+		s.stats.Nodes[node] = nodeCount
+	}
+	s.stats.Windows++
+	s.stats.ProductionVersion = productionVersion
+	s.stats.ShadowSource = shadowModel.Source
+	s.stats.ShadowVersion = shadowModel.Version
+	s.stats.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	for i := range rows {
+		agree := prediction[i] == production[i]
+		s.stats.add(agree, prediction[i] == 1)
+		nodeCount.add(agree, prediction[i] == 1)
+		if !agree {
+			log.Warnf("[Shadow] Disagreement in node %s. Production: %d, Shadow: %d, Features: %s",
+				node, production[i], prediction[i], s.featuresString(rows[i]))
+		}
+	}
+	return s.save()
+}
+
+// Stats returns a copy of the current stats
+func (s *Shadow) Stats() ShadowStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Nodes = make(map[string]*ShadowCount, len(s.stats.Nodes))
+	for k, v := range s.stats.Nodes {
+		count := *v
+		stats.Nodes[k] = &count
+	}
+	return stats
+}
+
+func (c *ShadowCount) add(agree, shadowPositive bool) {
+	c.Rows++
+	if agree {
+		c.Agreements++
+		return
+	}
+	c.Disagreements++
+	if shadowPositive {
+		c.ShadowPositives++
+	}
+}
+
+// AgreementRate returns the ratio of rows where both models agree
+func (c ShadowCount) AgreementRate() float64 {
+	if c.Rows == 0 {
+		return 0
+	}
+	return float64(c.Agreements) / float64(c.Rows)
+}
+
+func (s *Shadow) featuresString(row []float64) string {
+	values := make([]string, len(row))
+	for j, v := range row {
+		name := fmt.Sprintf("feature_%d", j)
+		if j < len(s.names) {
+			name = s.names[j]
+		}
+		values[j] = fmt.Sprintf("%s=%v", name, v)
+	}
+	return strings.Join(values, " ")
+}
+
+func (s *Shadow) save() error {
+	if s.statsFile == "" {
+		return nil
+	}
+	byteData, err := json.MarshalIndent(s.stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.statsFile, byteData, 0644)
+}
+
+// LoadShadowStats reads the stats stored by a shadow evaluation
+func LoadShadowStats(file string) (ShadowStats, error) {
+	var stats ShadowStats
+	byteData, err := ioutil.ReadFile(file)
+	if err != nil {
+		return stats, err
+	}
+	err = json.Unmarshal(byteData, &stats)
+	return stats, err
+}
+
+// Summary returns a readable report of the stats with the agreement rate of each node
+func (stats ShadowStats) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Shadow model v%d (%s, %s) vs production model v%d\n", stats.ShadowVersion, stats.ShadowSource, shortHash(stats.ShadowHash), stats.ProductionVersion)
+	fmt.Fprintf(&b, "Updated at: %s\n", stats.UpdatedAt)
+	fmt.Fprintf(&b, "Windows: %d, Rows: %d, Agreement rate: %.2f%%, Disagreements: %d (shadow positive: %d)\n",
+		stats.Windows, stats.Rows, stats.AgreementRate()*100, stats.Disagreements, stats.ShadowPositives)
+
+	nodes := make([]string, 0, len(stats.Nodes))
+	for k := range stats.Nodes {
+		nodes = append(nodes, k)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		count := stats.Nodes[node]
+		fmt.Fprintf(&b, "  Node %s -> Rows: %d, Agreement rate: %.2f%%, Disagreements: %d (shadow positive: %d)\n",
+			node, count.Rows, count.AgreementRate()*100, count.Disagreements, count.ShadowPositives)
+	}
+	return b.String()
+}
+
+// shortHash returns the beginning of a model hash, enough to tell the models apart in the logs
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// ResetShadowStats removes the stored stats, so that a new candidate is evaluated from scratch
+func ResetShadowStats(file string) error {
+	err := os.Remove(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShadowCountsDisagreements(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shadow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trainFile, testFile := writeDataset(t, dir)
+	modelFile := filepath.Join(dir, "model.json")
+	statsFile := filepath.Join(dir, "shadow_stats.json")
+
+	production := NewManager(trainFile, testFile, modelFile)
+	production.Training = TrainConfig{Iterations: 500, DecisionBoundary: 0.5}
+	err = production.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidate := NewManager(trainFile, testFile, modelFile)
+	candidate.ReadOnly = true
+	candidate.Training = production.TrainSettings()
+	err = candidate.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := [][]float64{{90, 5}, {10, 5}}
+	prediction, err := production.Current().Predict(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shadow := NewShadow(candidate, statsFile, []string{"first", "second"})
+	err = shadow.Compare("AA", rows, prediction, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The opposite predictions disagree with the shadow model in every row
+	opposite := []int{1 - prediction[0], 1 - prediction[1]}
+	err = shadow.Compare("BB", rows, opposite, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := shadow.Stats()
+	if stats.Windows != 2 || stats.Rows != 4 || stats.Agreements != 2 || stats.Disagreements != 2 {
+		t.Errorf("Stats = %+v, want 2 windows with 2 agreements and 2 disagreements", stats.ShadowCount)
+	}
+	if stats.Nodes["AA"].AgreementRate() != 1 || stats.Nodes["BB"].AgreementRate() != 0 {
+		t.Errorf("Agreement rates AA = %v, BB = %v, want 1 and 0", stats.Nodes["AA"].AgreementRate(), stats.Nodes["BB"].AgreementRate())
+	}
+	if err := shadow.Compare("AA", rows, []int{1}, 1); err == nil {
+		t.Error("Compared a prediction with a different number of rows")
+	}
+
+	stored, err := LoadShadowStats(statsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Rows != 4 || !strings.Contains(stored.Summary(), "Node BB") {
+		t.Errorf("Stored stats = %+v, want the 4 rows of both nodes", stored)
+	}
+	err = ResetShadowStats(statsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadShadowStats(statsFile); err == nil {
+		t.Error("Stats not removed by the reset")
+	}
+}
+
+func TestReadOnlyManagerNeedsModelFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shadow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	trainFile, testFile := writeDataset(t, dir)
+
+	manager := NewManager(trainFile, testFile, filepath.Join(dir, "missing.json"))
+	manager.ReadOnly = true
+	if manager.Load() == nil {
+		t.Error("Read-only manager trained a model without model file")
+	}
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/cdipaolo/goml/base"
+	"github.com/cdipaolo/goml/linear"
+	ml "github.com/ivangonzalezacuna/ml_regression_tracking"
+)
+
+// TrainConfig has the training settings of the Logistic Regression Model. The ml library keeps them
+// in the configuration file, so they are read once at startup instead of during the reloads
+type TrainConfig struct {
+	// Iterations of the gradient ascent. -1 searches the best ones together with the decision boundary
+	Iterations int
+	// DecisionBoundary is the minimum probability of a detection. -1 searches the best one
+	DecisionBoundary float64
+}
+
+// searched returns if the settings have to be searched before training
+func (c TrainConfig) searched() bool {
+	return c.Iterations < 0 || c.DecisionBoundary < 0
+}
+
+// trainBestModel trains the model with the settings, or with the most accurate ones against the
+// test data when they aren't set. It's the same search as ml.CreateBestModel, without reading or
+// writing the global configuration. Returns the model and the settings used
+func trainBestModel(xTrain [][]float64, yTrain []float64, xTest [][]float64, yTest []float64, config TrainConfig) (ml.ModelData, TrainConfig, error) {
+	if len(xTrain) == 0 || len(xTest) == 0 {
+		return ml.ModelData{}, config, fmt.Errorf("Received empty dataset")
+	}
+	if !config.searched() {
+		logistic, accuracy, err := trainLogistic(config, xTrain, yTrain, xTest, yTest)
+		if err != nil {
+			return ml.ModelData{}, config, err
+		}
+		return ml.ModelData{Model: logistic, DecissionBoundary: config.DecisionBoundary, Iterations: config.Iterations, Accuracy: accuracy}, config, nil
+	}
+
+	var best ml.ModelData
+	var bestConfig TrainConfig
+	for iterations := 100; iterations < 3300; iterations += 500 {
+		for db := 0.05; db < 1.0; db += 0.01 {
+			candidate := TrainConfig{Iterations: iterations, DecisionBoundary: db}
+			logistic, accuracy, err := trainLogistic(candidate, xTrain, yTrain, xTest, yTest)
+			if err != nil {
+				return ml.ModelData{}, config, err
+			}
+			if accuracy > best.Accuracy {
+				best = ml.ModelData{Model: logistic, DecissionBoundary: db, Iterations: iterations, Accuracy: accuracy}
+				bestConfig = candidate
+			}
+		}
+	}
+	return best, bestConfig, nil
+}
+
+// trainLogistic trains a model and returns its accuracy against the test data
+func trainLogistic(config TrainConfig, xTrain [][]float64, yTrain []float64, xTest [][]float64, yTest []float64) (*linear.Logistic, float64, error) {
+	logistic := linear.NewLogistic(base.BatchGA, 0.0001, 0.0, config.Iterations, xTrain, yTrain)
+	logistic.Output = ioutil.Discard
+	err := logistic.Learn()
+	if err != nil {
+		return nil, 0, err
+	}
+	hits := 0
+	for i := range xTest {
+		prediction, err := logistic.Predict(xTest[i])
+		if err != nil {
+			return nil, 0, err
+		}
+		if (prediction[0] >= config.DecisionBoundary) == (yTest[i] == 1) {
+			hits++
+		}
+	}
+	if len(xTest) == 0 {
+		return logistic, 0, nil
+	}
+	return logistic, float64(hits) / float64(len(xTest)), nil
+}
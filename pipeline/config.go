@@ -0,0 +1,195 @@
+package pipeline
+
+import (
+	"time"
+
+	datafusion "mainprocess/datafusion"
+	"mainprocess/model"
+	"mainprocess/tracker"
+	"mainprocess/transport"
+
+	"github.com/spf13/viper"
+)
+
+type (
+	// ModelConfig has the files of the model and its preprocessing, used when the pipeline has no classifier
+	ModelConfig struct {
+		TrainFile       string
+		TestFile        string
+		ModelFile       string
+		ReloadTolerance float64
+		Preprocessing   model.PreprocessConfig
+		// Training has the iterations and decision boundary, -1 to search them when training
+		Training model.TrainConfig
+		// ShadowModelFile is the candidate model evaluated next to the production one. Empty to disable it
+		ShadowModelFile string
+		ShadowStatsFile string
+	}
+
+	// Config has the settings of the pipeline
+	Config struct {
+		// MQTT has the settings of the broker used when the pipeline has no transport
+		MQTT transport.MQTTConfig
+		// NodeID identifies the node (room) where the sensors of the pipeline are placed
+		NodeID string
+		// Window is the time the sensors transmit after the first message of a window
+		Window time.Duration
+		// ShutdownTimeout is the time waited for the window in progress when the pipeline stops
+		ShutdownTimeout time.Duration
+		// MaxWindowDelay is the time a window can take after the window time before the pipeline isn't ready
+		MaxWindowDelay time.Duration
+		// MaxSensorSilence is the time without sensor messages before the pipeline isn't ready. 0 to disable it
+		MaxSensorSilence time.Duration
+		Model          ModelConfig
+		Drift          model.DriftConfig
+		Online         model.OnlineConfig
+		// DirectoryFile has the persons used to resolve the device identifiers. Empty to disable it
+		DirectoryFile string
+		// Embedded runs a tracker in the pipeline when none is given. Otherwise the detections are only published
+		Embedded bool
+		Tracker  tracker.Config
+		// APIAddress serves the query API of the tracker. Empty to disable it
+		APIAddress string
+		Tailgating datafusion.TailgatingConfig
+		// RecordFile is where the received messages are recorded to be replayed. Empty to disable it
+		RecordFile string
+	}
+)
+
+// ReadConfig reads the settings of the pipeline, writing the defaults of the missing ones
+func ReadConfig() Config {
+	var config Config
+	viper.SetDefault("mqtt.server", "tcp://127.0.0.1:1883")
+	config.MQTT.Server = viper.GetString("mqtt.server")
+	viper.Set("mqtt.server", config.MQTT.Server)
+	viper.SetDefault("mqtt.mainclientid", "main-client")
+	config.MQTT.ClientID = viper.GetString("mqtt.mainclientid")
+	viper.Set("mqtt.mainclientid", config.MQTT.ClientID)
+	viper.SetDefault("mqtt.keepAlive", 10)
+	keepAlive := viper.GetInt("mqtt.keepAlive")
+	viper.Set("mqtt.keepAlive", keepAlive)
+	config.MQTT.KeepAlive = time.Duration(keepAlive) * time.Second
+	viper.SetDefault("mqtt.pingTimeout", 1)
+	pingTimeout := viper.GetInt("mqtt.pingTimeout")
+	viper.Set("mqtt.pingTimeout", pingTimeout)
+	config.MQTT.PingTimeout = time.Duration(pingTimeout) * time.Second
+	viper.SetDefault("positioning.nodeID", "AA")
+	config.NodeID = viper.GetString("positioning.nodeID")
+	viper.Set("positioning.nodeID", config.NodeID)
+	viper.SetDefault("ml.window", 350)
+	window := viper.GetInt("ml.window")
+	viper.Set("ml.window", window)
+	config.Window = time.Duration(window) * time.Millisecond
+	viper.SetDefault("shutdown.timeout", 10)
+	shutdownTimeout := viper.GetInt("shutdown.timeout")
+	viper.Set("shutdown.timeout", shutdownTimeout)
+	config.ShutdownTimeout = time.Duration(shutdownTimeout) * time.Second
+	viper.SetDefault("health.maxWindowDelay", 10)
+	maxWindowDelay := viper.GetInt("health.maxWindowDelay")
+	viper.Set("health.maxWindowDelay", maxWindowDelay)
+	config.MaxWindowDelay = time.Duration(maxWindowDelay) * time.Second
+	viper.SetDefault("health.maxSensorSilence", 60)
+	maxSensorSilence := viper.GetInt("health.maxSensorSilence")
+	viper.Set("health.maxSensorSilence", maxSensorSilence)
+	config.MaxSensorSilence = time.Duration(maxSensorSilence) * time.Second
+
+	viper.SetDefault("ml.trainFile", "./data/train.csv")
+	config.Model.TrainFile = viper.GetString("ml.trainFile")
+	viper.Set("ml.trainFile", config.Model.TrainFile)
+	viper.SetDefault("ml.testFile", "./data/test.csv")
+	config.Model.TestFile = viper.GetString("ml.testFile")
+	viper.Set("ml.testFile", config.Model.TestFile)
+	viper.SetDefault("ml.modelFile", "./data/model.json")
+	config.Model.ModelFile = viper.GetString("ml.modelFile")
+	viper.Set("ml.modelFile", config.Model.ModelFile)
+	viper.SetDefault("ml.reloadTolerance", 0.02)
+	config.Model.ReloadTolerance = viper.GetFloat64("ml.reloadTolerance")
+	viper.Set("ml.reloadTolerance", config.Model.ReloadTolerance)
+	viper.SetDefault("ml.scaling", model.ScalingNone)
+	config.Model.Preprocessing.Scaling = viper.GetString("ml.scaling")
+	viper.Set("ml.scaling", config.Model.Preprocessing.Scaling)
+	viper.SetDefault("ml.clip", false)
+	config.Model.Preprocessing.Clip = viper.GetBool("ml.clip")
+	viper.Set("ml.clip", config.Model.Preprocessing.Clip)
+	viper.SetDefault("ml.logFeatures", []int{})
+	config.Model.Preprocessing.LogFeatures = viper.GetIntSlice("ml.logFeatures")
+	viper.Set("ml.logFeatures", config.Model.Preprocessing.LogFeatures)
+	viper.SetDefault("ml.iterations", -1)
+	config.Model.Training.Iterations = viper.GetInt("ml.iterations")
+	viper.SetDefault("ml.decissionBoundary", -1)
+	config.Model.Training.DecisionBoundary = viper.GetFloat64("ml.decissionBoundary")
+	viper.SetDefault("ml.shadowModelFile", "")
+	config.Model.ShadowModelFile = viper.GetString("ml.shadowModelFile")
+	viper.Set("ml.shadowModelFile", config.Model.ShadowModelFile)
+	viper.SetDefault("ml.shadowStatsFile", "./data/shadow_stats.json")
+	config.Model.ShadowStatsFile = viper.GetString("ml.shadowStatsFile")
+	viper.Set("ml.shadowStatsFile", config.Model.ShadowStatsFile)
+
+	viper.SetDefault("drift.method", model.DriftPSI)
+	config.Drift.Method = viper.GetString("drift.method")
+	viper.Set("drift.method", config.Drift.Method)
+	viper.SetDefault("drift.threshold", 0.25)
+	config.Drift.Threshold = viper.GetFloat64("drift.threshold")
+	viper.Set("drift.threshold", config.Drift.Threshold)
+	viper.SetDefault("drift.window", 500)
+	config.Drift.Window = viper.GetInt("drift.window")
+	viper.Set("drift.window", config.Drift.Window)
+	viper.SetDefault("drift.minSamples", 100)
+	config.Drift.MinSamples = viper.GetInt("drift.minSamples")
+	viper.Set("drift.minSamples", config.Drift.MinSamples)
+	viper.SetDefault("drift.bins", 10)
+	config.Drift.Bins = viper.GetInt("drift.bins")
+	viper.Set("drift.bins", config.Drift.Bins)
+
+	viper.SetDefault("online.learningRate", 0.0001)
+	config.Online.LearningRate = viper.GetFloat64("online.learningRate")
+	viper.Set("online.learningRate", config.Online.LearningRate)
+	viper.SetDefault("online.maxStep", 0.01)
+	config.Online.MaxStep = viper.GetFloat64("online.maxStep")
+	viper.Set("online.maxStep", config.Online.MaxStep)
+	viper.SetDefault("online.maxDistance", 0.1)
+	config.Online.MaxDistance = viper.GetFloat64("online.maxDistance")
+	viper.Set("online.maxDistance", config.Online.MaxDistance)
+	viper.SetDefault("online.windows", 1000)
+	config.Online.Windows = viper.GetInt("online.windows")
+	viper.Set("online.windows", config.Online.Windows)
+	viper.SetDefault("online.weightsFile", "./data/model.online.json")
+	config.Online.WeightsFile = viper.GetString("online.weightsFile")
+	viper.Set("online.weightsFile", config.Online.WeightsFile)
+
+	viper.SetDefault("directory.file", "")
+	config.DirectoryFile = viper.GetString("directory.file")
+	viper.Set("directory.file", config.DirectoryFile)
+
+	viper.SetDefault("tailgating.minCameraDetections", 1)
+	config.Tailgating.MinCameraDetections = viper.GetInt("tailgating.minCameraDetections")
+	viper.Set("tailgating.minCameraDetections", config.Tailgating.MinCameraDetections)
+	viper.SetDefault("tailgating.minPresence", 50.0)
+	config.Tailgating.MinPresence = viper.GetFloat64("tailgating.minPresence")
+	viper.Set("tailgating.minPresence", config.Tailgating.MinPresence)
+	viper.SetDefault("tailgating.minUnbadged", 1)
+	config.Tailgating.MinUnbadged = viper.GetInt("tailgating.minUnbadged")
+	viper.Set("tailgating.minUnbadged", config.Tailgating.MinUnbadged)
+
+	viper.SetDefault("record.file", "")
+	config.RecordFile = viper.GetString("record.file")
+	viper.Set("record.file", config.RecordFile)
+
+	viper.SetDefault("tracker.embedded", true)
+	config.Embedded = viper.GetBool("tracker.embedded")
+	viper.Set("tracker.embedded", config.Embedded)
+	viper.SetDefault("api.address", ":8080")
+	config.APIAddress = viper.GetString("api.address")
+	viper.Set("api.address", config.APIAddress)
+	viper.WriteConfig()
+
+	config.Tracker = tracker.ReadConfig()
+	return config
+}
+
+// writeTrainConfig stores the training settings found by the search, so they aren't searched again
+func writeTrainConfig(training model.TrainConfig) {
+	viper.Set("ml.iterations", training.Iterations)
+	viper.Set("ml.decissionBoundary", training.DecisionBoundary)
+	viper.WriteConfig()
+}
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"mainprocess/transport"
+)
+
+type (
+	// Status is the state of the pipeline returned by /healthz and /readyz
+	Status struct {
+		Ready bool `json:"ready"`
+		// Reasons explains why the pipeline isn't ready
+		Reasons []string      `json:"reasons,omitempty"`
+		Broker  BrokerStatus  `json:"broker"`
+		Model   ModelStatus   `json:"model"`
+		Windows WindowsStatus `json:"windows"`
+		Sensors SensorsStatus `json:"sensors"`
+	}
+
+	// BrokerStatus is the state of the transport
+	BrokerStatus struct {
+		Connected  bool `json:"connected"`
+		Subscribed bool `json:"subscribed"`
+	}
+
+	// ModelStatus is the model used for the predictions
+	ModelStatus struct {
+		Loaded  bool `json:"loaded"`
+		Version int  `json:"version,omitempty"`
+	}
+
+	// WindowsStatus has the last window closed and the window in progress
+	WindowsStatus struct {
+		// Last is when the last window was predicted. Empty before the first window
+		Last string `json:"last,omitempty"`
+		// OpenSince is when the window in progress was opened. Empty without window in progress
+		OpenSince string `json:"opensince,omitempty"`
+		// Late is true when the window in progress should have been closed already
+		Late bool `json:"late"`
+	}
+
+	// SensorsStatus has the last message received from the sensors
+	SensorsStatus struct {
+		// LastMessage is when the last sensor message was received. Empty before the first message
+		LastMessage string `json:"lastmessage,omitempty"`
+		// Silent is true when no sensor message was received during the maximum silence
+		Silent bool `json:"silent"`
+	}
+)
+
+// Status returns the state of the pipeline. It's ready when it's running, connected and subscribed to
+// the broker, the model is loaded, the window in progress closes in time and the sensors aren't silent
+func (p *Pipeline) Status() Status {
+	var status Status
+	p.mu.Lock()
+	running := p.running
+	lastWindow := p.lastWindow
+	opened := p.windowOpened
+	predicting := p.predicting
+	started := p.started
+	lastMessage := p.lastMessage
+	p.mu.Unlock()
+
+	status.Broker = BrokerStatus{Connected: running, Subscribed: running}
+	if broker, ok := p.transport.(transport.Status); ok {
+		status.Broker.Connected = broker.Connected()
+		status.Broker.Subscribed = running && broker.Subscribed()
+	}
+	if p.classifier != nil {
+		if current := p.classifier.Current(); current != nil {
+			status.Model = ModelStatus{Loaded: true, Version: current.Version}
+		}
+	}
+	if !lastWindow.IsZero() {
+		status.Windows.Last = lastWindow.Format(time.RFC3339Nano)
+	}
+	if predicting {
+		status.Windows.OpenSince = opened.Format(time.RFC3339Nano)
+		status.Windows.Late = time.Since(opened) > p.config.Window+p.config.MaxWindowDelay
+	}
+	// Before the first message, the silence is counted from the start of the pipeline
+	silentSince := started
+	if !lastMessage.IsZero() {
+		status.Sensors.LastMessage = lastMessage.Format(time.RFC3339Nano)
+		silentSince = lastMessage
+	}
+	status.Sensors.Silent = running && p.config.MaxSensorSilence > 0 && time.Since(silentSince) > p.config.MaxSensorSilence
+
+	if !running {
+		status.Reasons = append(status.Reasons, "pipeline not running")
+	}
+	if !status.Broker.Connected {
+		status.Reasons = append(status.Reasons, "not connected to the broker")
+	} else if !status.Broker.Subscribed {
+		status.Reasons = append(status.Reasons, "not subscribed to the topics")
+	}
+	if !status.Model.Loaded {
+		status.Reasons = append(status.Reasons, "model not loaded")
+	}
+	if status.Windows.Late {
+		status.Reasons = append(status.Reasons, "window not closed on schedule")
+	}
+	if status.Sensors.Silent {
+		status.Reasons = append(status.Reasons, "no sensor messages received")
+	}
+	status.Ready = len(status.Reasons) == 0
+	return status
+}
+
+// healthHandler answers while the process is alive, with the status of the pipeline
+func (p *Pipeline) healthHandler(w http.ResponseWriter, r *http.Request) {
+	p.writeStatus(w, r, p.Status(), http.StatusOK)
+}
+
+// readyHandler answers 503 Service Unavailable while the pipeline isn't ready
+func (p *Pipeline) readyHandler(w http.ResponseWriter, r *http.Request) {
+	status := p.Status()
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	p.writeStatus(w, r, status, code)
+}
+
+func (p *Pipeline) writeStatus(w http.ResponseWriter, r *http.Request, status Status, code int) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
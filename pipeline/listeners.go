@@ -0,0 +1,145 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	datafusion "mainprocess/datafusion"
+	"mainprocess/model"
+	"mainprocess/transport"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sensorDataListener opens a window with the first message received, and collects the data of the
+// sensors while the window is open
+func (p *Pipeline) sensorDataListener(msg transport.Message) {
+	p.metrics.messages.Inc(p.config.NodeID, sensorName(msg.Topic))
+	p.mu.Lock()
+	if !p.running {
+		p.mu.Unlock()
+		return
+	}
+	p.lastMessage = time.Now()
+	if !p.txFlag && !p.predicting && p.classifier.Current() != nil {
+		p.txFlag = true
+		p.predicting = true
+		p.windowOpened = time.Now()
+		p.windows.Add(1)
+		p.received = p.newCollectData()
+		p.mu.Unlock()
+		p.publishTxFlag(true)
+		go p.closeWindow(msg.Time)
+		return
+	}
+	if !p.txFlag {
+		p.mu.Unlock()
+		return
+	}
+	defer p.mu.Unlock()
+	p.collect(&p.received, msg.Topic, msg.Payload)
+}
+
+// collect adds the payload of a sensor topic to the data of the window
+func (p *Pipeline) collect(data *datafusion.CollectData, topic string, payload []byte) {
+	log.Tracef("Received: %v", string(payload))
+	sensor := sensorName(topic)
+	err := data.AddNewValue(payload, sensor)
+	if err != nil {
+		p.metrics.decodeErrors.Inc(p.config.NodeID, sensor)
+		log.Errorf(err.Error())
+	}
+}
+
+// closeWindow deactivates the txFlag after the window opened at start, or before if the pipeline stops,
+// and makes the prediction with the data collected
+func (p *Pipeline) closeWindow(start time.Time) {
+	defer p.windows.Done()
+	opened := time.Now()
+	timer := time.NewTimer(p.config.Window)
+	select {
+	case <-timer.C:
+	case <-p.stopping:
+		timer.Stop()
+		log.Infof("[Shutdown] Closing the window in progress")
+	}
+	p.mu.Lock()
+	p.txFlag = false
+	data := p.received
+	p.received = p.newCollectData()
+	p.mu.Unlock()
+
+	p.metrics.windowDuration.Observe(time.Since(opened).Seconds(), p.config.NodeID)
+	p.metrics.windowSize.Observe(float64(len(data.Camera)+len(data.Presence)+len(data.Rfid)+len(data.Wifi)), p.config.NodeID)
+	log.Debugf("[MQTT] Deactivating flag after %v!", p.config.Window)
+	p.publishTxFlag(false)
+	log.Infof("[MQTT] Camera size: %v\nPresence size: %v\nRfid size: %v\nWifi size: %v\n",
+		len(data.Camera), len(data.Presence), len(data.Rfid), len(data.Wifi))
+	err := p.makePredictions(data, start)
+	if err != nil {
+		log.Errorf(err.Error())
+	}
+
+	p.mu.Lock()
+	p.predicting = false
+	p.lastWindow = time.Now()
+	p.mu.Unlock()
+}
+
+// publishTxFlag allows or denies the transmission of data from each sensor
+func (p *Pipeline) publishTxFlag(txFlag bool) {
+	byteData, err := json.Marshal(txFlag)
+	if err != nil {
+		log.Errorf(err.Error())
+		return
+	}
+	err = p.transport.Publish(topicTxFlag, byteData)
+	if err != nil {
+		log.Errorf(fmt.Sprintf("Error publishing: %v", err))
+	}
+}
+
+func (p *Pipeline) feedbackListener(msg transport.Message) {
+	var feedback model.Feedback
+	err := json.Unmarshal(msg.Payload, &feedback)
+	if err != nil {
+		log.Errorf("[Online] Invalid feedback: %v", err.Error())
+		return
+	}
+	err = p.online.Apply(feedback)
+	if err != nil {
+		log.Errorf("[Online] Unable to apply feedback: %v", err.Error())
+	}
+}
+
+func (p *Pipeline) alarmAckListener(msg transport.Message) {
+	var request struct {
+		ID string `json:"id"`
+		By string `json:"by"`
+	}
+	err := json.Unmarshal(msg.Payload, &request)
+	if err != nil {
+		log.Errorf("[Alarm] Invalid acknowledge request: %v", err.Error())
+		return
+	}
+	_, err = p.tracker.Alarms().Acknowledge(request.ID, request.By)
+	if err != nil {
+		log.Errorf("[Alarm] Unable to acknowledge alarm: %v", err.Error())
+	}
+}
+
+func (p *Pipeline) alarmClearListener(msg transport.Message) {
+	var request struct {
+		ID string `json:"id"`
+	}
+	err := json.Unmarshal(msg.Payload, &request)
+	if err != nil {
+		log.Errorf("[Alarm] Invalid clear request: %v", err.Error())
+		return
+	}
+	_, err = p.tracker.Alarms().Clear(request.ID)
+	if err != nil {
+		log.Errorf("[Alarm] Unable to clear alarm: %v", err.Error())
+	}
+}
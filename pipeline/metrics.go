@@ -0,0 +1,63 @@
+package pipeline
+
+import (
+	"strconv"
+	"strings"
+
+	"mainprocess/metrics"
+)
+
+var (
+	// Buckets of the histograms
+	windowDurationBuckets = []float64{0.1, 0.25, 0.35, 0.5, 0.75, 1, 2.5, 5}
+	windowSizeBuckets     = []float64{0, 10, 25, 50, 100, 250, 500, 1000}
+	latencyBuckets        = []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+)
+
+// pipelineMetrics are the metrics updated by the pipeline, served in /metrics
+type pipelineMetrics struct {
+	messages       *metrics.Counter
+	decodeErrors   *metrics.Counter
+	windowDuration *metrics.Histogram
+	windowSize     *metrics.Histogram
+	fusion         *metrics.Histogram
+	prediction     *metrics.Histogram
+	detections     *metrics.Counter
+}
+
+// registerMetrics creates the metrics of the pipeline and the embedded tracker. The tracker counters
+// and the model version are read when the metrics are written
+func (p *Pipeline) registerMetrics() {
+	p.registry = metrics.NewRegistry()
+	p.metrics = pipelineMetrics{
+		messages:       p.registry.Counter("mainprocess_messages_total", "Messages received from the sensors.", "node", "sensor"),
+		decodeErrors:   p.registry.Counter("mainprocess_decode_errors_total", "Sensor messages that couldn't be decoded or resolved.", "node", "sensor"),
+		windowDuration: p.registry.Histogram("mainprocess_window_duration_seconds", "Time the windows were open.", windowDurationBuckets, "node"),
+		windowSize:     p.registry.Histogram("mainprocess_window_messages", "Sensor messages collected in each window.", windowSizeBuckets, "node"),
+		fusion:         p.registry.Histogram("mainprocess_fusion_seconds", "Time joining the data of a window and calculating the features.", latencyBuckets, "node"),
+		prediction:     p.registry.Histogram("mainprocess_prediction_seconds", "Time predicting the persons of a window with the model.", latencyBuckets, "node"),
+		detections:     p.registry.Counter("mainprocess_detections_total", "Persons detected in the node.", "node"),
+	}
+
+	if p.tracker != nil {
+		p.tracker.RegisterMetrics(p.registry)
+	}
+	p.registry.Func("mainprocess_model_info", "Version of the model used for the predictions.", metrics.TypeGauge, []string{"version"}, func() []metrics.Sample {
+		current := p.classifier.Current()
+		if current == nil {
+			return nil
+		}
+		return []metrics.Sample{{LabelValues: []string{strconv.Itoa(current.Version)}, Value: 1}}
+	})
+}
+
+// Metrics returns the metrics of the pipeline
+func (p *Pipeline) Metrics() *metrics.Registry {
+	return p.registry
+}
+
+// sensorName returns the sensor of a sensor topic: /Nodes/Node_ID/Tracking/Sensor/<sensor>
+func sensorName(topic string) string {
+	split := strings.Split(topic, "/")
+	return strings.ToLower(split[len(split)-1])
+}
@@ -0,0 +1,466 @@
+package pipeline
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	datafusion "mainprocess/datafusion"
+	"mainprocess/directory"
+	"mainprocess/metrics"
+	"mainprocess/model"
+	"mainprocess/tracker"
+	"mainprocess/transport"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// Topic names used by the pipeline
+	topicSensor    = "/Nodes/Node_ID/Tracking/Sensor/+"
+	topicTxFlag    = "/Nodes/Node_ID/Tracking/TxFlag"
+	topicDetection = "/Nodes/Node_%v/Tracking/Detection"
+	topicDrift     = "/Nodes/Node_%v/Tracking/Drift"
+	// Feedback of the operators about the detections of a window
+	topicFeedback = "/Nodes/Node_%v/Tracking/Feedback"
+	// Windows where persons without badge entered with a badged one
+	topicTailgating = "/Nodes/Node_%v/Tracking/Tailgating"
+)
+
+type (
+	// Option sets one of the components of the pipeline
+	Option func(*Pipeline)
+
+	// Pipeline collects the data of the sensors of a node during each window, fuses it, predicts the
+	// persons in the node and sends the detections to the tracker
+	Pipeline struct {
+		config     Config
+		configured bool
+		transport  transport.Transport
+		// mqtt is the transport created by the pipeline when none is given, connected when it starts
+		mqtt *transport.MQTT
+		// classifier keeps the model used for the predictions
+		classifier *model.Manager
+		// Detector of differences between the live features and the train data
+		drift *model.DriftDetector
+		// Evaluation of a candidate model next to the production one. Nil when disabled
+		shadow        *model.Shadow
+		shadowManager *model.Manager
+		// Incremental update of the model from the feedback of the operators
+		online *model.OnlineLearner
+		// Persons with the identifiers of their devices. Nil when there is no directory file
+		directory *directory.Directory
+		// tracker of the persons detected in the node. Nil when the tracker isn't embedded
+		tracker *tracker.Tracker
+		// recorder writes the received messages to the record file. Nil when they aren't recorded
+		recorder   *transport.Recorder
+		httpServer *http.Server
+		registry   *metrics.Registry
+		metrics    pipelineMetrics
+		// The components created by the pipeline are closed when it stops, the given ones aren't
+		ownClassifier bool
+		ownTracker    bool
+
+		mu      sync.Mutex
+		running bool
+		// A stopped pipeline has its components closed, so it can't be started again
+		stopped bool
+		// received has the data of the sensors in the current window
+		received datafusion.CollectData
+		// txFlag allows the sensors to transmit. It's active while the window is open
+		txFlag bool
+		// predicting is true from the start of a window until its prediction ends, so that only
+		// one window is processed at a time
+		predicting bool
+		// windowOpened is when the window in progress was opened, and lastWindow when the last one was predicted
+		windowOpened time.Time
+		lastWindow   time.Time
+		// started is when the pipeline started, and lastMessage when the last sensor message was received
+		started     time.Time
+		lastMessage time.Time
+		// windows counts the windows in progress, waited when the pipeline stops
+		windows sync.WaitGroup
+		// stopping is closed when the pipeline stops, so the open window is closed without waiting
+		stopping chan struct{}
+	}
+)
+
+// WithConfig sets the settings of the pipeline. Without it, they are read with ReadConfig
+func WithConfig(config Config) Option {
+	return func(p *Pipeline) {
+		p.config = config
+		p.configured = true
+	}
+}
+
+// WithTransport sets the transport used to receive the sensor data and publish the results. It must
+// be connected by the caller. Without it, the pipeline connects to the MQTT broker of the settings
+func WithTransport(t transport.Transport) Option {
+	return func(p *Pipeline) {
+		p.transport = t
+	}
+}
+
+// WithClassifier sets the manager of the model used for the predictions. Without it, the model is
+// loaded from the model settings
+func WithClassifier(manager *model.Manager) Option {
+	return func(p *Pipeline) {
+		p.classifier = manager
+	}
+}
+
+// WithTracker sets the tracker of the detections. Without it, a tracker is created with the tracker
+// settings if the tracker is embedded
+func WithTracker(t *tracker.Tracker) Option {
+	return func(p *Pipeline) {
+		p.tracker = t
+	}
+}
+
+// New creates a pipeline with the given components, and creates the missing ones from its settings
+func New(options ...Option) (*Pipeline, error) {
+	p := &Pipeline{stopping: make(chan struct{})}
+	for _, option := range options {
+		option(p)
+	}
+	if !p.configured {
+		p.config = ReadConfig()
+	}
+
+	err := p.setup()
+	if err != nil {
+		p.close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Pipeline) setup() error {
+	if p.transport == nil {
+		p.mqtt = transport.NewMQTT(p.config.MQTT)
+		p.transport = p.mqtt
+	}
+
+	err := p.loadClassifier()
+	if err != nil {
+		return err
+	}
+	p.drift, err = model.NewDriftDetector(p.config.Drift, datafusion.FeatureNames)
+	if err != nil {
+		return err
+	}
+	err = p.loadShadowModel()
+	if err != nil {
+		return err
+	}
+	p.online, err = model.NewOnlineLearner(p.classifier, p.config.Online)
+	if err != nil {
+		return err
+	}
+	err = p.loadDirectory()
+	if err != nil {
+		return err
+	}
+	if p.config.RecordFile != "" {
+		p.recorder, err = transport.NewRecorder(p.config.RecordFile)
+		if err != nil {
+			return fmt.Errorf("Can't record messages in %s: %v", p.config.RecordFile, err.Error())
+		}
+		log.Infof("[Init] Recording the received messages in %s", p.config.RecordFile)
+	}
+
+	if p.tracker == nil && p.config.Embedded {
+		p.tracker, err = tracker.New(p.config.Tracker, p.transport)
+		if err != nil {
+			return err
+		}
+		p.ownTracker = true
+	}
+	if p.tracker == nil {
+		log.Infof("[Init] Tracker not embedded, detections are only published to %s", fmt.Sprintf(topicDetection, p.config.NodeID))
+	}
+	p.received = p.newCollectData()
+	p.registerMetrics()
+	return nil
+}
+
+func (p *Pipeline) loadClassifier() error {
+	if p.classifier != nil {
+		if features := p.classifier.Current().Features(); features != len(datafusion.FeatureNames) {
+			return fmt.Errorf("Model has %d features but the sensors provide %d: %s", features, len(datafusion.FeatureNames), strings.Join(datafusion.FeatureNames, ", "))
+		}
+		return nil
+	}
+	p.classifier = model.NewManager(p.config.Model.TrainFile, p.config.Model.TestFile, p.config.Model.ModelFile)
+	p.classifier.Features = len(datafusion.FeatureNames)
+	p.classifier.Tolerance = p.config.Model.ReloadTolerance
+	p.classifier.Preprocessing = p.config.Model.Preprocessing
+	p.classifier.Training = p.config.Model.Training
+	p.ownClassifier = true
+	err := p.classifier.Load()
+	if err != nil {
+		return err
+	}
+	// The settings found by the search are stored now, so the reloads in background never write the configuration
+	if training := p.classifier.TrainSettings(); training != p.config.Model.Training {
+		p.config.Model.Training = training
+		writeTrainConfig(training)
+	}
+
+	log.Debugf("[Init] ModelData: %#v", p.classifier.Current().ModelData)
+	return p.classifier.Watch()
+}
+
+func (p *Pipeline) loadShadowModel() error {
+	if p.config.Model.ShadowModelFile == "" {
+		return nil
+	}
+
+	p.shadowManager = model.NewManager(p.config.Model.TrainFile, p.config.Model.TestFile, p.config.Model.ShadowModelFile)
+	p.shadowManager.ReadOnly = true
+	p.shadowManager.Features = len(datafusion.FeatureNames)
+	p.shadowManager.Training = p.config.Model.Training
+	err := p.shadowManager.Load()
+	if err != nil {
+		return fmt.Errorf("Can't load shadow model: %v", err.Error())
+	}
+	err = p.shadowManager.Watch()
+	if err != nil {
+		return err
+	}
+	p.shadow = model.NewShadow(p.shadowManager, p.config.Model.ShadowStatsFile, datafusion.FeatureNames)
+	return nil
+}
+
+// loadDirectory loads the persons of the directory file, used to resolve the RFID tags, WiFi devices
+// and camera labels of the sensor data. An empty file disables it
+func (p *Pipeline) loadDirectory() error {
+	if p.config.DirectoryFile == "" {
+		log.Infof("[Init] No person directory configured, the sensors must send the person ID")
+		return nil
+	}
+
+	var err error
+	p.directory, err = directory.Load(p.config.DirectoryFile)
+	if err != nil {
+		return err
+	}
+	return p.directory.Watch()
+}
+
+// newCollectData creates the data of a new window, resolving the device identifiers with the directory
+func (p *Pipeline) newCollectData() datafusion.CollectData {
+	data := datafusion.CollectData{}
+	if p.directory != nil {
+		data.Resolver = p.directory
+	}
+	return data
+}
+
+// Tracker returns the tracker of the detections, nil when the tracker isn't embedded
+func (p *Pipeline) Tracker() *tracker.Tracker {
+	return p.tracker
+}
+
+// Classifier returns the manager of the model used for the predictions
+func (p *Pipeline) Classifier() *model.Manager {
+	return p.classifier
+}
+
+// Start serves the query API and subscribes to the topics, connecting to the broker when the pipeline
+// has no given transport, so it starts receiving the data of the sensors
+func (p *Pipeline) Start() error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return fmt.Errorf("Pipeline already stopped")
+	}
+	if p.running {
+		p.mu.Unlock()
+		return fmt.Errorf("Pipeline already started")
+	}
+	p.running = true
+	p.started = time.Now()
+	p.mu.Unlock()
+
+	err := p.connect()
+	if err != nil {
+		p.mu.Lock()
+		p.running = false
+		p.mu.Unlock()
+		if p.httpServer != nil {
+			p.httpServer.Close()
+			p.httpServer = nil
+		}
+	}
+	return err
+}
+
+func (p *Pipeline) connect() error {
+	err := p.startHTTPServer()
+	if err != nil {
+		return err
+	}
+
+	err = p.subscribeToTopics()
+	if err != nil {
+		return err
+	}
+	// The subscriptions of the MQTT transport are done once connected
+	if p.mqtt != nil {
+		return p.mqtt.Connect()
+	}
+	return nil
+}
+
+// Stop stops opening new windows, closes the open window and waits until its detections are predicted
+// and stored, up to the shutdown timeout. Then it publishes a final txFlag=false, disconnects from the
+// broker and closes the components created by the pipeline. A stopped pipeline can't be started again
+func (p *Pipeline) Stop() error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return fmt.Errorf("Pipeline already stopped")
+	}
+	running := p.running
+	p.running = false
+	p.stopped = true
+	p.mu.Unlock()
+
+	if !running {
+		return p.close()
+	}
+	close(p.stopping)
+	if !p.waitWindows(p.config.ShutdownTimeout) {
+		log.Warnf("[Shutdown] The window in progress didn't finish in %v, stopping anyway", p.config.ShutdownTimeout)
+	}
+	// The sensors may still be transmitting if the last txFlag was lost
+	p.publishTxFlag(false)
+	if p.mqtt != nil {
+		p.mqtt.Close()
+	}
+	return p.close()
+}
+
+// waitWindows waits for the windows in progress. Returns false if they didn't finish in the timeout
+func (p *Pipeline) waitWindows(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		p.windows.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// close closes the components created by the pipeline
+func (p *Pipeline) close() error {
+	var err error
+	if p.httpServer != nil {
+		err = p.httpServer.Close()
+		p.httpServer = nil
+	}
+	if p.tracker != nil && p.ownTracker {
+		err = firstError(err, p.tracker.Close())
+	}
+	if p.directory != nil {
+		err = firstError(err, p.directory.Close())
+	}
+	if p.shadowManager != nil {
+		err = firstError(err, p.shadowManager.Close())
+	}
+	if p.recorder != nil {
+		err = firstError(err, p.recorder.Close())
+	}
+	if p.classifier != nil && p.ownClassifier {
+		err = firstError(err, p.classifier.Close())
+	}
+	return err
+}
+
+func firstError(err, next error) error {
+	if err != nil {
+		return err
+	}
+	return next
+}
+
+// startHTTPServer serves the metrics and the query API of the tracker in the API address. An empty
+// address disables it
+func (p *Pipeline) startHTTPServer() error {
+	if p.config.APIAddress == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", p.registry.Handler())
+	mux.HandleFunc("/healthz", p.healthHandler)
+	mux.HandleFunc("/readyz", p.readyHandler)
+	if p.tracker != nil {
+		mux.Handle("/api/", http.StripPrefix("/api", p.tracker.Handler()))
+	}
+	// The address is taken before returning, so a port in use stops the start
+	listener, err := net.Listen("tcp", p.config.APIAddress)
+	if err != nil {
+		return fmt.Errorf("Can't listen in %s: %v", p.config.APIAddress, err.Error())
+	}
+	p.httpServer = &http.Server{Handler: mux}
+	go func(server *http.Server) {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("[API] %v", err.Error())
+		}
+	}(p.httpServer)
+	log.Infof("[API] Serving the metrics in %s/metrics, and the status in %s/healthz and %s/readyz", p.config.APIAddress, p.config.APIAddress, p.config.APIAddress)
+	if p.tracker != nil {
+		log.Infof("[API] Serving the tracker API in %s/api", p.config.APIAddress)
+	}
+	return nil
+}
+
+func (p *Pipeline) subscribeToTopics() error {
+	err := p.subscribe(topicSensor, p.sensorDataListener)
+	if err != nil {
+		return err
+	}
+	err = p.subscribe(fmt.Sprintf(topicFeedback, p.config.NodeID), p.whileRunning(p.feedbackListener))
+	if err != nil {
+		return err
+	}
+	if p.tracker == nil {
+		return nil
+	}
+	err = p.subscribe(p.config.Tracker.AlarmClearTopic, p.whileRunning(p.alarmClearListener))
+	if err != nil {
+		return err
+	}
+	return p.subscribe(p.config.Tracker.AlarmAckTopic, p.whileRunning(p.alarmAckListener))
+}
+
+// subscribe receives the messages of a topic, recording them before they are handled
+func (p *Pipeline) subscribe(topic string, handler transport.Handler) error {
+	if p.recorder != nil {
+		handler = p.recorder.Handler(handler)
+	}
+	return p.transport.Subscribe(topic, handler)
+}
+
+// whileRunning ignores the messages received when the pipeline isn't running, because the given
+// transports keep delivering them after the pipeline stops
+func (p *Pipeline) whileRunning(handler transport.Handler) transport.Handler {
+	return func(msg transport.Message) {
+		p.mu.Lock()
+		running := p.running
+		p.mu.Unlock()
+		if running {
+			handler(msg)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	datafusion "mainprocess/datafusion"
+	"mainprocess/model"
+	"mainprocess/transport"
+)
+
+// testConfig returns the settings of a pipeline with a model trained on synthetic data: a person
+// seen by the camera and the RFID reader is detected, a person only seen by the WiFi isn't
+func testConfig(t *testing.T, dir string, window time.Duration) Config {
+	var data strings.Builder
+	for i := 0; i < 50; i++ {
+		strong, weak := float64(60+i%40), float64(i%20)
+		fmt.Fprintf(&data, "%v,%v,%v,%v,%v,%v,1\n", float64(i%100), weak, -80.0, strong, -50.0, strong)
+		fmt.Fprintf(&data, "%v,%v,%v,%v,%v,%v,0\n", float64(i%100), strong, -70.0, weak, -100.0, weak)
+	}
+	for _, name := range []string{"train.csv", "test.csv"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data.String()), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return Config{
+		NodeID:          "AA",
+		Window:          window,
+		ShutdownTimeout: 5 * time.Second,
+		MaxWindowDelay:  time.Second,
+		// The silence is long enough for the tests that don't send messages
+		MaxSensorSilence: time.Minute,
+		Model: ModelConfig{
+			TrainFile: filepath.Join(dir, "train.csv"),
+			TestFile:  filepath.Join(dir, "test.csv"),
+			Training:  model.TrainConfig{Iterations: 1000, DecisionBoundary: 0.5},
+		},
+		Drift:      model.DriftConfig{Method: model.DriftPSI, Threshold: 0.25, Window: 100, MinSamples: 10, Bins: 10},
+		Online:     model.OnlineConfig{LearningRate: 0.0001, MaxStep: 0.01, MaxDistance: 0.1, Windows: 10},
+		Tailgating: datafusion.TailgatingConfig{MinCameraDetections: 1, MinPresence: 50, MinUnbadged: 1},
+	}
+}
+
+// publishWindow sends the messages of a window: person 5 is seen by the camera and the RFID reader,
+// and person 7 only by the WiFi
+func publishWindow(t *testing.T, memory *transport.Memory) {
+	messages := []struct {
+		sensor  string
+		payload string
+	}{
+		{"camera", `{"sensor": "camera", "timestamp": "1", "person": 5}`},
+		{"rfid", `{"sensor": "rfid", "timestamp": "1", "person": 5, "power": -50}`},
+		{"wifi", `{"sensor": "wifi", "timestamp": "1", "person": 7, "rssi": -70}`},
+		{"camera", `{"sensor": "camera", "timestamp": "2", "person": 5}`},
+	}
+	for _, message := range messages {
+		err := memory.Publish("/Nodes/Node_ID/Tracking/Sensor/"+message.sensor, []byte(message.payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// subscribe returns the payloads published to a topic
+func subscribe(t *testing.T, memory *transport.Memory, topic string) <-chan []byte {
+	payloads := make(chan []byte, 10)
+	err := memory.Subscribe(topic, func(msg transport.Message) {
+		payloads <- msg.Payload
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payloads
+}
+
+// nextDetection waits for the person of the next detection published by the pipeline
+func nextDetection(t *testing.T, detections <-chan []byte) int {
+	select {
+	case payload := <-detections:
+		var detection datafusion.PredictionDataStruct
+		err := json.Unmarshal(payload, &detection)
+		if err != nil {
+			t.Fatalf("Invalid detection %s: %v", payload, err)
+		}
+		return detection.Person
+	case <-time.After(5 * time.Second):
+		t.Fatal("No detection published")
+		return 0
+	}
+}
+
+func newTestPipeline(t *testing.T, window time.Duration) (*Pipeline, *transport.Memory, func()) {
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := transport.NewMemory()
+	p, err := New(WithConfig(testConfig(t, dir, window)), WithTransport(memory))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return p, memory, func() {
+		memory.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFeatureCountMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := testConfig(t, dir, time.Second)
+	// The data has one feature less than the sensors provide
+	var data strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&data, "%v,0,-80,60,-50,1\n%v,60,-70,0,-100,0\n", i, i)
+	}
+	for _, file := range []string{config.Model.TrainFile, config.Model.TestFile} {
+		err = ioutil.WriteFile(file, []byte(data.String()), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	memory := transport.NewMemory()
+	defer memory.Close()
+	_, err = New(WithConfig(config), WithTransport(memory))
+	if err == nil || !strings.Contains(err.Error(), "has 5 features but the data to predict has 6") {
+		t.Errorf("New() error = %v, want the feature count mismatch", err)
+	}
+}
+
+func TestDetectionsWithMemoryTransport(t *testing.T) {
+	p, memory, cleanup := newTestPipeline(t, 200*time.Millisecond)
+	defer cleanup()
+	detections := subscribe(t, memory, fmt.Sprintf(topicDetection, "AA"))
+	err := p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	publishWindow(t, memory)
+	if person := nextDetection(t, detections); person != 5 {
+		t.Errorf("Detected person %d, want 5", person)
+	}
+	select {
+	case payload := <-detections:
+		t.Errorf("Unexpected detection %s", payload)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	var output strings.Builder
+	err = p.Metrics().Write(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`mainprocess_messages_total{node="AA",sensor="camera"} 2`,
+		`mainprocess_messages_total{node="AA",sensor="wifi"} 1`,
+		`mainprocess_window_messages_count{node="AA"} 1`,
+		`mainprocess_detections_total{node="AA"} 1`,
+		`mainprocess_model_info{version="1"} 1`,
+	} {
+		if !strings.Contains(output.String(), line+"\n") {
+			t.Errorf("Metrics without %s:\n%s", line, output.String())
+		}
+	}
+}
+
+func TestStopDrainsOpenWindow(t *testing.T) {
+	// The window lasts an hour, so only Stop closes it
+	p, memory, cleanup := newTestPipeline(t, time.Hour)
+	defer cleanup()
+	detections := subscribe(t, memory, fmt.Sprintf(topicDetection, "AA"))
+	flags := subscribe(t, memory, topicTxFlag)
+	err := p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publishWindow(t, memory)
+	select {
+	case flag := <-flags:
+		if string(flag) != "true" {
+			t.Fatalf("First txFlag %s, want the window opened", flag)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Window not opened")
+	}
+	err = p.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The detection was published before Stop returned, the memory transport delivers it in background
+	if person := nextDetection(t, detections); person != 5 {
+		t.Errorf("Detected person %d, want 5", person)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case flag := <-flags:
+			if string(flag) != "false" {
+				t.Errorf("txFlag %s after stopping, want false", flag)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Window closed without the txFlag and the final txFlag")
+		}
+	}
+	if p.Stop() == nil {
+		t.Error("Stopping twice didn't fail")
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	p, memory, cleanup := newTestPipeline(t, time.Hour)
+	defer cleanup()
+	ready := httptest.NewServer(http.HandlerFunc(p.readyHandler))
+	defer ready.Close()
+	health := httptest.NewServer(http.HandlerFunc(p.healthHandler))
+	defer health.Close()
+
+	get := func(server *httptest.Server, code int) Status {
+		response, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		var status Status
+		json.NewDecoder(response.Body).Decode(&status)
+		if response.StatusCode != code {
+			t.Errorf("GET returned %d with %+v, want %d", response.StatusCode, status, code)
+		}
+		return status
+	}
+
+	if status := get(ready, http.StatusServiceUnavailable); status.Ready || !status.Model.Loaded {
+		t.Errorf("Status before Start = %+v, want not ready with the model loaded", status)
+	}
+	err := p.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := get(ready, http.StatusOK); !status.Ready || !status.Broker.Subscribed {
+		t.Errorf("Status after Start = %+v, want ready", status)
+	}
+
+	// A window that should have been closed already makes the pipeline not ready
+	p.mu.Lock()
+	p.predicting = true
+	p.windowOpened = time.Now().Add(-2 * time.Hour)
+	p.mu.Unlock()
+	if status := get(ready, http.StatusServiceUnavailable); !status.Windows.Late {
+		t.Errorf("Status with a late window = %+v, want late", status)
+	}
+	if status := get(health, http.StatusOK); status.Ready {
+		t.Errorf("Health with a late window = %+v, want not ready", status)
+	}
+	p.mu.Lock()
+	p.predicting = false
+	// Sensors that stopped sending messages make the pipeline not ready, until a message arrives
+	p.started = time.Now().Add(-2 * time.Minute)
+	p.mu.Unlock()
+	if status := get(ready, http.StatusServiceUnavailable); !status.Sensors.Silent || status.Sensors.LastMessage != "" {
+		t.Errorf("Status without sensor messages = %+v, want silent sensors", status)
+	}
+	publishWindow(t, memory)
+	deadline := time.After(time.Second)
+	for status := p.Status(); !status.Ready; status = p.Status() {
+		select {
+		case <-deadline:
+			t.Fatalf("Status after a sensor message = %+v, want ready", status)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if status := get(ready, http.StatusOK); status.Sensors.Silent || status.Sensors.LastMessage == "" {
+		t.Errorf("Status after a sensor message = %+v, want the last message", status)
+	}
+
+	err = p.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := get(ready, http.StatusServiceUnavailable); status.Ready {
+		t.Errorf("Status after Stop = %+v, want not ready", status)
+	}
+}
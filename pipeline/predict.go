@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	datafusion "mainprocess/datafusion"
+	"mainprocess/model"
+	"mainprocess/tracker"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// makePredictions fuses the data of the window opened at start, predicts the persons in the node and
+// publishes the detections
+func (p *Pipeline) makePredictions(data datafusion.CollectData, start time.Time) error {
+	t1 := time.Now()
+	// The model is taken once, so a reload during the window doesn't affect this prediction
+	currentModel := p.classifier.Current()
+	nodeID := p.config.NodeID
+	// The window is identified by its first message, so the replays of a recording have the same IDs
+	windowID := fmt.Sprintf("%v-%d", nodeID, start.UnixNano())
+
+	// Calculate the AVG result / list of results from the whole data received from each sensor
+	generatedData := datafusion.JoinedData{}
+	err := generatedData.GetFinalValues(data)
+	if err != nil {
+		return fmt.Errorf("Can't make prediction: %v", err.Error())
+	}
+
+	log.Debugf("[Prediction] CAMERA -> %#v", generatedData.Camera)
+	log.Debugf("[Prediction] PRESENCE -> %#v", generatedData.Presence)
+	log.Debugf("[Prediction] RFID -> %#v", generatedData.Rfid)
+	log.Debugf("[Prediction] WiFi -> %#v", generatedData.Wifi)
+	p.checkTailgating(generatedData, windowID)
+
+	// Obtain a final list with the data to send to the ML algorithm
+	predictionDataStruct := datafusion.FinalData{}
+	predictionDataStruct.ObtainFinalData(generatedData)
+	persons := make([]int, len(predictionDataStruct))
+	for k := range predictionDataStruct {
+		predictionDataStruct[k].Window = windowID
+		persons[k] = predictionDataStruct[k].Person
+	}
+
+	result, err := json.MarshalIndent(predictionDataStruct, "", "  ")
+	if err != nil {
+		return err
+	}
+	log.Debugf("[Prediction] %v", string(result))
+
+	predictionData := predictionDataStruct.To2DFloatArray()
+	p.metrics.fusion.Observe(time.Since(t1).Seconds(), nodeID)
+	log.Debugf("[Prediction] Obtained 2D Array to predict: %v", predictionData)
+	p.checkDrift(predictionData, currentModel)
+	if len(predictionData) > 0 {
+		p.online.Remember(windowID, persons, predictionData)
+	}
+
+	predictionStart := time.Now()
+	prediction, err := currentModel.Predict(predictionData)
+	if err != nil {
+		return err
+	}
+	p.metrics.prediction.Observe(time.Since(predictionStart).Seconds(), nodeID)
+	log.Infof("[Prediction] Result of prediction (model v%d): %v", currentModel.Version, prediction)
+	if p.shadow != nil {
+		// The shadow prediction is only compared, it never reaches the tracker
+		err = p.shadow.Compare(nodeID, predictionData, prediction, currentModel.Version)
+		if err != nil {
+			log.Warnf("[Shadow] Unable to evaluate shadow model: %v", err.Error())
+		}
+	}
+
+	t2 := time.Now()
+	log.Debugf("[Prediction] Time doing join and calculating final data array: %v", t2.Sub(t1))
+
+	if len(prediction) != len(predictionDataStruct) {
+		return fmt.Errorf("Prediction results sizes mismatch")
+	}
+	var detections []tracker.Detection
+	for k := range predictionDataStruct {
+		if prediction[k] == 1 {
+			predictionDataStruct[k].Detection = true
+			p.metrics.detections.Inc(nodeID)
+			byteData, err := json.Marshal(predictionDataStruct[k])
+			if err != nil {
+				return err
+			}
+			err = p.transport.Publish(fmt.Sprintf(topicDetection, nodeID), byteData)
+			if err != nil {
+				log.Errorf(fmt.Sprintf("Error publishing: %v", err))
+			}
+			detections = append(detections, tracker.NewDetection(predictionDataStruct[k], fmt.Sprintf("Node_%v", nodeID)))
+		}
+	}
+
+	// The detections of the window are checked together, so the escorts are taken into account
+	if p.tracker != nil && len(detections) > 0 {
+		_, err = p.tracker.ProcessWindow(detections)
+		if err != nil {
+			log.Errorf("[Tracker] Unable to process detections of window %s: %v", windowID, err.Error())
+		}
+	}
+	return nil
+}
+
+// checkTailgating compares the persons seen by the camera with the RFID badges of the window, and
+// publishes the analysis when persons without badge entered with a badged one
+func (p *Pipeline) checkTailgating(generatedData datafusion.JoinedData, windowID string) {
+	analysis := generatedData.AnalyzeTailgating(p.config.Tailgating)
+	if !analysis.Detected {
+		return
+	}
+	log.Warnf("[Tailgating] %d persons entered node %s with %d badges in window %s", analysis.CameraPersons, p.config.NodeID, analysis.Badges, windowID)
+
+	byteData, err := json.Marshal(analysis)
+	if err != nil {
+		log.Errorf(err.Error())
+		return
+	}
+	err = p.transport.Publish(fmt.Sprintf(topicTailgating, p.config.NodeID), byteData)
+	if err != nil {
+		log.Errorf(fmt.Sprintf("Error publishing: %v", err))
+	}
+	if p.tracker != nil {
+		_, _, err = p.tracker.Tailgating(fmt.Sprintf("Node_%v", p.config.NodeID), analysis)
+		if err != nil {
+			log.Errorf("[Tracker] Unable to raise tailgating alarm of window %s: %v", windowID, err.Error())
+		}
+	}
+}
+
+// checkDrift compares the features of the window with the train data of the model and publishes
+// a warning for each feature that starts or stops drifting
+func (p *Pipeline) checkDrift(predictionData [][]float64, currentModel *model.Model) {
+	warnings, err := p.drift.Observe(p.config.NodeID, predictionData, currentModel.Reference)
+	if err != nil {
+		log.Warnf("[Drift] Unable to check drift: %v", err.Error())
+		return
+	}
+
+	for _, warning := range warnings {
+		if warning.Drifted {
+			log.Warnf("[Drift] Feature %s of node %s drifted. %s: %.4f (threshold %.4f)", warning.Feature, warning.Node, warning.Method, warning.Value, warning.Threshold)
+		} else {
+			log.Infof("[Drift] Feature %s of node %s is back to the train distribution. %s: %.4f", warning.Feature, warning.Node, warning.Method, warning.Value)
+		}
+		byteData, err := json.Marshal(warning)
+		if err != nil {
+			log.Errorf(err.Error())
+			continue
+		}
+		err = p.transport.Publish(fmt.Sprintf(topicDrift, p.config.NodeID), byteData)
+		if err != nil {
+			log.Errorf(fmt.Sprintf("Error publishing: %v", err))
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	datafusion "mainprocess/datafusion"
+	"mainprocess/transport"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Replay feeds the recorded sensor messages through the fusion and the model as fast as possible. As in
+// the live pipeline, the first message of a window opens it and the messages recorded during the window
+// time are collected. The windows only depend on the recorded times, so every replay of a recording
+// gives the same detections. The pipeline must not be started
+func (p *Pipeline) Replay(records []transport.Record) error {
+	p.mu.Lock()
+	if p.running || p.stopped {
+		p.mu.Unlock()
+		return fmt.Errorf("Can't replay in a started pipeline")
+	}
+	p.mu.Unlock()
+
+	var (
+		data  datafusion.CollectData
+		start time.Time
+		open  bool
+	)
+	for _, record := range records {
+		if !transport.Match(topicSensor, record.Topic) {
+			continue
+		}
+		if open && record.Time.Sub(start) >= p.config.Window {
+			p.replayWindow(data, start)
+			open = false
+		}
+		// The message that opens the window isn't collected, because the sensors weren't transmitting yet
+		if !open {
+			open = true
+			start = record.Time
+			data = p.newCollectData()
+			continue
+		}
+		p.collect(&data, record.Topic, []byte(record.Payload))
+	}
+	if open {
+		p.replayWindow(data, start)
+	}
+	return nil
+}
+
+func (p *Pipeline) replayWindow(data datafusion.CollectData, start time.Time) {
+	log.Infof("[Replay] Window of %s. Camera size: %v, Presence size: %v, Rfid size: %v, Wifi size: %v",
+		start.Format(time.RFC3339Nano), len(data.Camera), len(data.Presence), len(data.Rfid), len(data.Wifi))
+	err := p.makePredictions(data, start)
+	if err != nil {
+		log.Errorf(err.Error())
+	}
+}
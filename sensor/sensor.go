@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"math/rand"
 	"os"
@@ -10,14 +11,16 @@ import (
 	"strconv"
 	"time"
 
-	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"mainprocess/pipeline"
+	"mainprocess/transport"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
 var (
-	txFlagListener mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
-		err := json.Unmarshal(msg.Payload(), &txFlag)
+	txFlagListener transport.Handler = func(msg transport.Message) {
+		err := json.Unmarshal(msg.Payload, &txFlag)
 		if err != nil {
 			log.Errorf(err.Error())
 			return
@@ -25,8 +28,8 @@ var (
 		log.Infof("[MQTT] TxFlag updated to ´%v´", txFlag)
 	}
 
-	mqttClient mqtt.Client
-	txFlag     bool
+	sensorTransport transport.Transport
+	txFlag          bool
 
 	topicCamera   = "/Nodes/Node_ID/Tracking/Sensor/Camera"
 	topicPresence = "/Nodes/Node_ID/Tracking/Sensor/Presence"
@@ -38,8 +41,11 @@ var (
 func init() {
 	log.SetLevel(log.DebugLevel)
 	txFlag = false
-
 	readConfig()
+}
+
+// connect connects the simulator to the MQTT broker
+func connect() error {
 	viper.SetDefault("mqtt.server", "tcp://127.0.0.1:1883")
 	server := viper.GetString("mqtt.server")
 	viper.Set("mqtt.server", server)
@@ -54,23 +60,38 @@ func init() {
 	viper.Set("mqtt.pingTimeout", pingTimeout)
 	viper.WriteConfig()
 
-	opts := mqtt.NewClientOptions().AddBroker(server).SetClientID(clientID)
-	opts.SetKeepAlive(time.Duration(keepAlive) * time.Second)
-	opts.SetPingTimeout(time.Duration(pingTimeout) * time.Second)
-	opts.SetOnConnectHandler(func(client mqtt.Client) {
-		err := subscribeToTopics()
-		if err != nil {
-			log.Errorf(err.Error())
-			os.Exit(400)
-		}
+	mqttTransport := transport.NewMQTT(transport.MQTTConfig{
+		Server:      server,
+		ClientID:    clientID,
+		KeepAlive:   time.Duration(keepAlive) * time.Second,
+		PingTimeout: time.Duration(pingTimeout) * time.Second,
 	})
+	sensorTransport = mqttTransport
+	// The subscriptions are done once connected
+	err := subscribeToTopics()
+	if err != nil {
+		return err
+	}
+	return mqttTransport.Connect()
+}
 
-	log.Infof("[MQTT] Connecting to MQTT broker...")
-	mqttClient = mqtt.NewClient(opts)
-	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
-		log.Errorf(token.Error().Error())
-		os.Exit(400)
+// startDemo runs the pipeline in this process with an in-memory transport, so no broker is needed
+func startDemo() error {
+	memory := transport.NewMemory()
+	sensorTransport = memory
+	err := subscribeToTopics()
+	if err != nil {
+		return err
 	}
+
+	config := pipeline.ReadConfig()
+	config.Embedded = false
+	config.APIAddress = ""
+	fusion, err := pipeline.New(pipeline.WithConfig(config), pipeline.WithTransport(memory))
+	if err != nil {
+		return err
+	}
+	return fusion.Start()
 }
 
 func readConfig() {
@@ -102,14 +123,23 @@ func readConfig() {
 }
 
 func subscribeToTopics() error {
-	log.Infof("[MQTT] Subscribing to MQTT Topic...")
-	if token := mqttClient.Subscribe(topicTxFlag, 0, txFlagListener); token.Wait() && token.Error() != nil {
-		return token.Error()
-	}
-	return nil
+	return sensorTransport.Subscribe(topicTxFlag, txFlagListener)
 }
 
 func main() {
+	demo := flag.Bool("memory", false, "Run the main process in this process, without MQTT broker")
+	flag.Parse()
+	var err error
+	if *demo {
+		err = startDemo()
+	} else {
+		err = connect()
+	}
+	if err != nil {
+		log.Errorf(err.Error())
+		os.Exit(400)
+	}
+
 	for {
 		go auxSendCamera()
 		go auxSendPresence()
@@ -135,9 +165,9 @@ func auxSendCamera() {
 			return
 		}
 		if txFlag {
-			token := mqttClient.Publish(topicCamera, 0, false, byteData)
-			if token.Wait() && token.Error() != nil {
-				log.Errorf(fmt.Sprintf("Error publishing: %v", token.Error()))
+			err := sensorTransport.Publish(topicCamera, byteData)
+			if err != nil {
+				log.Errorf(fmt.Sprintf("Error publishing: %v", err))
 			}
 		} else {
 			log.Warnf("Unable to send Camera data")
@@ -158,9 +188,9 @@ func auxSendCamera() {
 			return
 		}
 		if txFlag {
-			token := mqttClient.Publish(topicCamera, 0, false, byteData)
-			if token.Wait() && token.Error() != nil {
-				log.Errorf(fmt.Sprintf("Error publishing: %v", token.Error()))
+			err := sensorTransport.Publish(topicCamera, byteData)
+			if err != nil {
+				log.Errorf(fmt.Sprintf("Error publishing: %v", err))
 			}
 		} else {
 			log.Warnf("Unable to send Camera data")
@@ -181,9 +211,9 @@ func auxSendCamera() {
 			return
 		}
 		if txFlag {
-			token := mqttClient.Publish(topicCamera, 0, false, byteData)
-			if token.Wait() && token.Error() != nil {
-				log.Errorf(fmt.Sprintf("Error publishing: %v", token.Error()))
+			err := sensorTransport.Publish(topicCamera, byteData)
+			if err != nil {
+				log.Errorf(fmt.Sprintf("Error publishing: %v", err))
 			}
 		} else {
 			log.Warnf("Unable to send Camera data")
@@ -212,9 +242,9 @@ func auxSendPresence() {
 			return
 		}
 		if txFlag || (!txFlag && detection) {
-			token := mqttClient.Publish(topicPresence, 0, false, byteData)
-			if token.Wait() && token.Error() != nil {
-				log.Errorf(fmt.Sprintf("Error publishing: %v", token.Error()))
+			err := sensorTransport.Publish(topicPresence, byteData)
+			if err != nil {
+				log.Errorf(fmt.Sprintf("Error publishing: %v", err))
 			}
 		} else {
 			log.Warnf("Unable to send Presence data")
@@ -243,9 +273,9 @@ func auxSendRfid() {
 			return
 		}
 		if txFlag || (!txFlag && (power >= float64(-40))) {
-			token := mqttClient.Publish(topicRfid, 0, false, byteData)
-			if token.Wait() && token.Error() != nil {
-				log.Errorf(fmt.Sprintf("Error publishing: %v", token.Error()))
+			err := sensorTransport.Publish(topicRfid, byteData)
+			if err != nil {
+				log.Errorf(fmt.Sprintf("Error publishing: %v", err))
 			}
 		} else {
 			log.Warnf("Unable to send Rfid data")
@@ -268,9 +298,9 @@ func auxSendRfid() {
 			return
 		}
 		if txFlag || (!txFlag && (power >= float64(-40))) {
-			token := mqttClient.Publish(topicRfid, 0, false, byteData)
-			if token.Wait() && token.Error() != nil {
-				log.Errorf(fmt.Sprintf("Error publishing: %v", token.Error()))
+			err := sensorTransport.Publish(topicRfid, byteData)
+			if err != nil {
+				log.Errorf(fmt.Sprintf("Error publishing: %v", err))
 			}
 		} else {
 			log.Warnf("Unable to send Rfid data")
@@ -293,9 +323,9 @@ func auxSendRfid() {
 			return
 		}
 		if txFlag || (!txFlag && (power >= float64(-40))) {
-			token := mqttClient.Publish(topicRfid, 0, false, byteData)
-			if token.Wait() && token.Error() != nil {
-				log.Errorf(fmt.Sprintf("Error publishing: %v", token.Error()))
+			err := sensorTransport.Publish(topicRfid, byteData)
+			if err != nil {
+				log.Errorf(fmt.Sprintf("Error publishing: %v", err))
 			}
 		} else {
 			log.Warnf("Unable to send Rfid data")
@@ -324,9 +354,9 @@ func auxSendWifi() {
 			return
 		}
 		if txFlag {
-			token := mqttClient.Publish(topicWifi, 0, false, byteData)
-			if token.Wait() && token.Error() != nil {
-				log.Errorf(fmt.Sprintf("Error publishing: %v", token.Error()))
+			err := sensorTransport.Publish(topicWifi, byteData)
+			if err != nil {
+				log.Errorf(fmt.Sprintf("Error publishing: %v", err))
 			}
 		} else {
 			log.Warnf("Unable to send Wifi data")
@@ -349,9 +379,9 @@ func auxSendWifi() {
 			return
 		}
 		if txFlag {
-			token := mqttClient.Publish(topicWifi, 0, false, byteData)
-			if token.Wait() && token.Error() != nil {
-				log.Errorf(fmt.Sprintf("Error publishing: %v", token.Error()))
+			err := sensorTransport.Publish(topicWifi, byteData)
+			if err != nil {
+				log.Errorf(fmt.Sprintf("Error publishing: %v", err))
 			}
 		} else {
 			log.Warnf("Unable to send Wifi data")
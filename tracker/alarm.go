@@ -0,0 +1,259 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Severities of the alarms
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Kinds of alarms
+const (
+	// AlarmPermission is raised when a person is detected in a room without permission
+	AlarmPermission = "permission"
+	// AlarmCapacity is raised when there are more persons in a room than its capacity. It has no person
+	AlarmCapacity = "capacity"
+	// AlarmTailgating is raised when persons without badge enter a room with a badged one. It has no person
+	AlarmTailgating = "tailgating"
+)
+
+type (
+	// Publisher sends a payload to a topic of the broker
+	Publisher interface {
+		Publish(topic string, payload []byte) error
+	}
+
+	// Alarm is generated when a person is detected in a room without permission, or when a room is
+	// over its capacity
+	Alarm struct {
+		ID        string             `json:"id"`
+		Kind      string             `json:"kind"`
+		Person    int                `json:"person"`
+		Room      string             `json:"room"`
+		Reason    string             `json:"reason"`
+		Severity  string             `json:"severity"`
+		Timestamp string             `json:"timestamp"`
+		Features  map[string]float64 `json:"features,omitempty"`
+		Open      bool               `json:"open"`
+		// Count is the number of detections that triggered the alarm, including the suppressed ones
+		Count    int    `json:"count"`
+		LastSeen string `json:"lastseen"`
+		// Acknowledged alarms are still open, but they aren't escalated
+		Acknowledged   bool   `json:"acknowledged"`
+		AcknowledgedBy string `json:"acknowledgedby,omitempty"`
+		AcknowledgedAt string `json:"acknowledgedat,omitempty"`
+		ClearedAt      string `json:"clearedat,omitempty"`
+	}
+
+	// AlarmManager keeps the open alarms and publishes them. Repeated alarms of the same person
+	// and room are suppressed during the cooldown, and every alarm stays open until it's cleared
+	AlarmManager struct {
+		publisher Publisher
+		topic     string
+		cooldown  time.Duration
+		// notifier sends the alarms to the notification sinks. When nil, they are only published
+		notifier *Notifier
+
+		mu        sync.Mutex
+		open      map[string]*Alarm
+		published map[string]time.Time
+		// raised counts the alarms opened of each kind
+		raised map[string]uint64
+	}
+)
+
+// NewAlarmManager creates an alarm manager publishing the alarms in the topic and sending them to
+// the notifier. The publisher and the notifier can be nil, so the alarms are only logged
+func NewAlarmManager(publisher Publisher, topic string, cooldown time.Duration, notifier *Notifier) *AlarmManager {
+	return &AlarmManager{
+		publisher: publisher,
+		topic:     topic,
+		cooldown:  cooldown,
+		notifier:  notifier,
+		open:      make(map[string]*Alarm),
+		published: make(map[string]time.Time),
+		raised:    make(map[string]uint64),
+	}
+}
+
+// Raise opens a new alarm, or updates the open alarm of the same kind, person and room. The alarm is
+// published unless the same alarm was published during the cooldown. Returns the current alarm,
+// if it was published and the error publishing it. The alarm is published and notified after
+// releasing the lock, so a slow broker or sink never blocks the other alarms
+func (a *AlarmManager) Raise(alarm Alarm) (Alarm, bool, error) {
+	a.mu.Lock()
+
+	now := time.Now()
+	if alarm.Kind == "" {
+		alarm.Kind = AlarmPermission
+	}
+	key := alarmKey(alarm)
+	current, ok := a.open[key]
+	if !ok {
+		alarm.ID = fmt.Sprintf("%d-%s-%d", alarm.Person, alarm.Room, now.UnixNano())
+		if alarm.Kind != AlarmPermission {
+			alarm.ID = fmt.Sprintf("%s-%s-%d", alarm.Kind, alarm.Room, now.UnixNano())
+		}
+		alarm.Open = true
+		alarm.Count = 0
+		if alarm.Timestamp == "" {
+			alarm.Timestamp = now.Format(time.RFC3339)
+		}
+		current = &alarm
+		a.open[key] = current
+		a.raised[alarm.Kind]++
+	} else {
+		// Keep the reason and features of the last detection, but the identity of the first one
+		current.Reason = alarm.Reason
+		current.Features = alarm.Features
+		if alarm.Severity == SeverityCritical {
+			current.Severity = SeverityCritical
+		}
+	}
+	current.Count++
+	current.LastSeen = now.Format(time.RFC3339)
+
+	if last, ok := a.published[key]; ok && now.Sub(last) < a.cooldown {
+		log.Debugf("[Alarm] Suppressed %s alarm %s of user %d in room %s (%d detections)", current.Kind, current.ID, current.Person, current.Room, current.Count)
+		a.mu.Unlock()
+		return *current, false, nil
+	}
+	if current.Kind != AlarmPermission {
+		log.Warnf("[Alarm] %s %s alarm %s: room %s. %s", current.Severity, current.Kind, current.ID, current.Room, current.Reason)
+	} else {
+		log.Warnf("[Alarm] %s %s alarm %s: user %d in room %s. %s", current.Severity, current.Kind, current.ID, current.Person, current.Room, current.Reason)
+	}
+	// The cooldown starts even if the alarm couldn't be published, because it was already notified
+	a.published[key] = now
+	raised := *current
+	a.mu.Unlock()
+
+	if a.notifier != nil {
+		a.notifier.raised(raised, !ok, a.pending)
+	}
+	err := a.publish(raised)
+	if err != nil {
+		return raised, false, err
+	}
+	return raised, true, nil
+}
+
+// Acknowledge marks an open alarm as handled by someone, so it isn't escalated, and publishes it
+func (a *AlarmManager) Acknowledge(id, by string) (Alarm, error) {
+	a.mu.Lock()
+	var acknowledged *Alarm
+	for _, alarm := range a.open {
+		if alarm.ID != id {
+			continue
+		}
+		alarm.Acknowledged = true
+		alarm.AcknowledgedBy = by
+		alarm.AcknowledgedAt = time.Now().Format(time.RFC3339)
+		copied := *alarm
+		acknowledged = &copied
+		break
+	}
+	a.mu.Unlock()
+	if acknowledged == nil {
+		return Alarm{}, fmt.Errorf("Alarm %s not found", id)
+	}
+
+	log.Infof("[Alarm] Alarm %s acknowledged by %s", acknowledged.ID, by)
+	if a.notifier != nil {
+		a.notifier.acknowledged(acknowledged.ID)
+	}
+	return *acknowledged, a.publish(*acknowledged)
+}
+
+// Clear closes an open alarm by its ID and publishes it as cleared. The alarm is closed even if
+// it couldn't be published
+func (a *AlarmManager) Clear(id string) (Alarm, error) {
+	a.mu.Lock()
+	var cleared *Alarm
+	for key, alarm := range a.open {
+		if alarm.ID != id {
+			continue
+		}
+		delete(a.open, key)
+		delete(a.published, key)
+		alarm.Open = false
+		alarm.ClearedAt = time.Now().Format(time.RFC3339)
+		cleared = alarm
+		break
+	}
+	a.mu.Unlock()
+	if cleared == nil {
+		return Alarm{}, fmt.Errorf("Alarm %s not found", id)
+	}
+
+	log.Infof("[Alarm] Cleared alarm %s of user %d in room %s", cleared.ID, cleared.Person, cleared.Room)
+	if a.notifier != nil {
+		a.notifier.cleared(*cleared)
+	}
+	return *cleared, a.publish(*cleared)
+}
+
+// Open returns the open alarms, sorted by the time they were raised
+func (a *AlarmManager) Open() []Alarm {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	alarms := make([]Alarm, 0, len(a.open))
+	for _, alarm := range a.open {
+		alarms = append(alarms, *alarm)
+	}
+	sort.Slice(alarms, func(i, j int) bool {
+		return alarms[i].Timestamp < alarms[j].Timestamp
+	})
+	return alarms
+}
+
+// Raised returns the number of alarms opened of each kind
+func (a *AlarmManager) Raised() map[string]uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	raised := make(map[string]uint64, len(a.raised))
+	for kind, count := range a.raised {
+		raised[kind] = count
+	}
+	return raised
+}
+
+// pending returns an alarm while it's open and not acknowledged
+func (a *AlarmManager) pending(id string) (Alarm, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, alarm := range a.open {
+		if alarm.ID == id && !alarm.Acknowledged {
+			return *alarm, true
+		}
+	}
+	return Alarm{}, false
+}
+
+func (a *AlarmManager) publish(alarm Alarm) error {
+	if a.publisher == nil {
+		return nil
+	}
+	byteData, err := json.Marshal(alarm)
+	if err != nil {
+		return err
+	}
+	err = a.publisher.Publish(a.topic, byteData)
+	if err != nil {
+		return fmt.Errorf("Error publishing alarm %s: %v", alarm.ID, err.Error())
+	}
+	return nil
+}
+
+func alarmKey(alarm Alarm) string {
+	return fmt.Sprintf("%s/%d/%s", alarm.Kind, alarm.Person, alarm.Room)
+}
@@ -0,0 +1,192 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPublisher keeps the alarms published to each topic, or fails while broken
+type testPublisher struct {
+	mu       sync.Mutex
+	messages map[string][][]byte
+	broken   bool
+}
+
+func (p *testPublisher) Publish(topic string, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.broken {
+		return fmt.Errorf("Broker disconnected")
+	}
+	if p.messages == nil {
+		p.messages = make(map[string][][]byte)
+	}
+	p.messages[topic] = append(p.messages[topic], payload)
+	return nil
+}
+
+func (p *testPublisher) alarms(t *testing.T, topic string) []Alarm {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var alarms []Alarm
+	for _, payload := range p.messages[topic] {
+		var alarm Alarm
+		err := json.Unmarshal(payload, &alarm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		alarms = append(alarms, alarm)
+	}
+	return alarms
+}
+
+func TestAlarmCooldown(t *testing.T) {
+	publisher := &testPublisher{}
+	manager := NewAlarmManager(publisher, "/Tracking/Alarms", time.Hour, nil)
+
+	first, published, err := manager.Raise(Alarm{Person: 1, Room: "Node_AA", Reason: "no rule", Severity: SeverityWarning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !published || !first.Open || first.Count != 1 || first.ID == "" {
+		t.Fatalf("First alarm = %+v (published %v), want a new open alarm", first, published)
+	}
+	repeated, published, _ := manager.Raise(Alarm{Person: 1, Room: "Node_AA", Reason: "denied", Severity: SeverityCritical})
+	if published {
+		t.Error("Repeated alarm published during the cooldown")
+	}
+	if repeated.ID != first.ID || repeated.Count != 2 || repeated.Severity != SeverityCritical || repeated.Reason != "denied" {
+		t.Errorf("Repeated alarm = %+v, want the first alarm updated", repeated)
+	}
+	other, published, _ := manager.Raise(Alarm{Person: 1, Room: "Node_BB", Severity: SeverityWarning})
+	if !published || other.ID == first.ID {
+		t.Errorf("Alarm of another room = %+v (published %v), want a new alarm", other, published)
+	}
+
+	if alarms := publisher.alarms(t, "/Tracking/Alarms"); len(alarms) != 2 {
+		t.Errorf("Published %d alarms, want 2", len(alarms))
+	}
+	if open := manager.Open(); len(open) != 2 {
+		t.Errorf("Open alarms = %v, want 2", open)
+	}
+}
+
+func TestAlarmClear(t *testing.T) {
+	publisher := &testPublisher{}
+	manager := NewAlarmManager(publisher, "/Tracking/Alarms", time.Hour, nil)
+	alarm, _, _ := manager.Raise(Alarm{Person: 1, Room: "Node_AA", Severity: SeverityWarning})
+
+	cleared, err := manager.Clear(alarm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared.Open || cleared.ClearedAt == "" {
+		t.Errorf("Cleared alarm = %+v, want closed", cleared)
+	}
+	if _, err := manager.Clear(alarm.ID); err == nil {
+		t.Error("Cleared an alarm twice")
+	}
+	if open := manager.Open(); len(open) != 0 {
+		t.Errorf("Open alarms after clearing = %v", open)
+	}
+
+	// After clearing, the same person and room raise a new alarm without waiting for the cooldown
+	again, published, _ := manager.Raise(Alarm{Person: 1, Room: "Node_AA", Severity: SeverityWarning})
+	if !published || again.ID == alarm.ID {
+		t.Errorf("Alarm after clearing = %+v (published %v), want a new alarm", again, published)
+	}
+	alarms := publisher.alarms(t, "/Tracking/Alarms")
+	if len(alarms) != 3 || alarms[1].Open {
+		t.Errorf("Published alarms = %+v, want raised, cleared and raised", alarms)
+	}
+	if raised := manager.Raised(); raised[AlarmPermission] != 2 {
+		t.Errorf("Raised alarms = %v, want 2 permission alarms", raised)
+	}
+}
+
+func TestAlarmPublishError(t *testing.T) {
+	publisher := &testPublisher{broken: true}
+	manager := NewAlarmManager(publisher, "/Tracking/Alarms", time.Hour, nil)
+
+	alarm, published, err := manager.Raise(Alarm{Person: 1, Room: "Node_AA", Severity: SeverityWarning})
+	if err == nil || published || !alarm.Open {
+		t.Fatalf("Raise with a broken publisher = %+v (published %v, error %v), want an open alarm not published", alarm, published, err)
+	}
+
+	// The cooldown starts anyway, because the alarm was already notified
+	publisher.mu.Lock()
+	publisher.broken = false
+	publisher.mu.Unlock()
+	alarm, published, err = manager.Raise(Alarm{Person: 1, Room: "Node_AA", Severity: SeverityWarning})
+	if err != nil || published || alarm.Count != 2 {
+		t.Errorf("Raise after reconnecting = %+v (published %v, error %v), want the alarm suppressed", alarm, published, err)
+	}
+}
+
+// testSink keeps the notifications it receives
+type testSink struct {
+	notifications chan Notification
+}
+
+func (s *testSink) Name() string {
+	return "test"
+}
+
+func (s *testSink) Notify(notification Notification) error {
+	s.notifications <- notification
+	return nil
+}
+
+// next waits for the next notification of the sink, failing after a second
+func (s *testSink) next(t *testing.T) Notification {
+	select {
+	case notification := <-s.notifications:
+		return notification
+	case <-time.After(time.Second):
+		t.Fatal("Notification not received")
+		return Notification{}
+	}
+}
+
+func TestAlarmEscalation(t *testing.T) {
+	tier1 := &testSink{notifications: make(chan Notification, 10)}
+	tier2 := &testSink{notifications: make(chan Notification, 10)}
+	notifier := NewNotifier([]Sink{tier1}, []Sink{tier2}, 0, 0, 50*time.Millisecond)
+	manager := NewAlarmManager(&testPublisher{}, "/Tracking/Alarms", time.Hour, notifier)
+
+	escalated, _, _ := manager.Raise(Alarm{Person: 1, Room: "Node_AA", Severity: SeverityWarning})
+	acknowledged, _, _ := manager.Raise(Alarm{Person: 2, Room: "Node_AA", Severity: SeverityWarning})
+	for i := 0; i < 2; i++ {
+		if notification := tier1.next(t); notification.Event != NotifyRaised || notification.Tier != 1 {
+			t.Errorf("First tier notification = %+v, want raised", notification)
+		}
+	}
+	alarm, err := manager.Acknowledge(acknowledged.ID, "operator")
+	if err != nil || !alarm.Acknowledged || alarm.AcknowledgedBy != "operator" || !alarm.Open {
+		t.Fatalf("Acknowledge = %+v (error %v), want the open alarm acknowledged by the operator", alarm, err)
+	}
+	if _, err := manager.Acknowledge("unknown", "operator"); err == nil {
+		t.Error("Acknowledged an unknown alarm")
+	}
+
+	// Only the alarm that wasn't acknowledged is escalated
+	notification := tier2.next(t)
+	if notification.Event != NotifyEscalated || notification.Tier != 2 || notification.Alarm.ID != escalated.ID {
+		t.Errorf("Second tier notification = %+v, want alarm %s escalated", notification, escalated.ID)
+	}
+	select {
+	case notification := <-tier2.notifications:
+		t.Errorf("Acknowledged alarm escalated: %+v", notification)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := manager.Clear(escalated.ID); err != nil {
+		t.Fatal(err)
+	}
+	if notification := tier1.next(t); notification.Event != NotifyCleared || notification.Alarm.Open {
+		t.Errorf("Notification of the cleared alarm = %+v, want cleared", notification)
+	}
+}
@@ -0,0 +1,222 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Limits of the pages returned by the query API
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// Page is a slice of the results of a query
+type Page struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Items  interface{} `json:"items"`
+}
+
+// Handler returns the HTTP JSON API to query the locations and alarms of the tracker:
+//
+//	GET /persons/<id>/location   current location of a person
+//	GET /persons/<id>/history    locations of a person
+//	GET /rooms/<room>/occupants  stored location of the persons in a room now
+//	GET /rooms/<room>/occupancy  number of persons detected in a room now
+//	GET /rooms/<room>/history    locations stored in a room
+//	GET /alarms                  open alarms
+//
+// The history accepts the time range in the from and to parameters (RFC3339), and every list
+// is paginated with the offset and limit parameters
+func (t *Tracker) Handler() http.Handler {
+	return http.HandlerFunc(t.serveAPI)
+}
+
+func (t *Tracker) serveAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method %s not allowed", r.Method))
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "alarms":
+		t.serveAlarms(w, r)
+	case len(parts) == 3 && parts[0] == "persons":
+		person, err := strconv.Atoi(parts[1])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid person %s", parts[1]))
+			return
+		}
+		switch parts[2] {
+		case "location":
+			t.servePersonLocation(w, person)
+		case "history":
+			t.serveHistory(w, r, LocationQuery{Person: &person})
+		default:
+			http.NotFound(w, r)
+		}
+	case len(parts) == 3 && parts[0] == "rooms":
+		switch parts[2] {
+		case "occupants":
+			t.serveOccupants(w, r, parts[1])
+		case "occupancy":
+			writeJSON(w, t.Occupancy(parts[1]))
+		case "history":
+			t.serveHistory(w, r, LocationQuery{Room: parts[1]})
+		default:
+			http.NotFound(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (t *Tracker) servePersonLocation(w http.ResponseWriter, person int) {
+	location, ok, err := t.store.LastForPerson(person)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("No location stored for user %d", person))
+		return
+	}
+	writeJSON(w, location)
+}
+
+func (t *Tracker) serveOccupants(w http.ResponseWriter, r *http.Request, room string) {
+	offset, limit, err := pagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// The occupants are the persons counted in the room now, the persons that left it aren't listed
+	// even if it's their last stored location
+	occupancy := t.Occupancy(room)
+	occupants := make([]LocationStruct, 0, len(occupancy.Persons))
+	for _, person := range occupancy.Persons {
+		location, ok, err := t.store.LastForPerson(person)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if !ok || location.Location != room {
+			location = LocationStruct{Person: person, Location: room}
+		}
+		occupants = append(occupants, location)
+	}
+	writeJSON(w, paginate(occupants, offset, limit))
+}
+
+func (t *Tracker) serveHistory(w http.ResponseWriter, r *http.Request, query LocationQuery) {
+	offset, limit, err := pagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	query.From, err = timeParameter(r, "from")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	query.To, err = timeParameter(r, "to")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	history, err := t.store.Query(query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if history == nil {
+		history = make([]LocationStruct, 0)
+	}
+	writeJSON(w, paginate(history, offset, limit))
+}
+
+func (t *Tracker) serveAlarms(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := pagination(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	alarms := t.alarms.Open()
+	start, end := pageRange(len(alarms), offset, limit)
+	writeJSON(w, Page{Total: len(alarms), Offset: offset, Limit: limit, Items: alarms[start:end]})
+}
+
+func paginate(locations []LocationStruct, offset, limit int) Page {
+	start, end := pageRange(len(locations), offset, limit)
+	return Page{Total: len(locations), Offset: offset, Limit: limit, Items: locations[start:end]}
+}
+
+// pageRange returns the indexes of the page in the results
+func pageRange(total, offset, limit int) (int, int) {
+	start, end := offset, offset+limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// pagination reads the offset and limit parameters of the request
+func pagination(r *http.Request) (int, int, error) {
+	offset, limit := 0, defaultPageLimit
+	var err error
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("Invalid offset %s", value)
+		}
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("Invalid limit %s", value)
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+	}
+	return offset, limit, nil
+}
+
+// timeParameter reads a RFC3339 time of the request. Missing parameters return the zero time
+func timeParameter(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid %s time %s, expected RFC3339", name, value)
+	}
+	return at, nil
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		log.Errorf("[API] Error writing response: %v", err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,86 @@
+package tracker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tracker, _ := newTestTracker(t, dir, &testPublisher{})
+	defer tracker.Close()
+	for _, detection := range []Detection{
+		{Timestamp: "1", Person: 1, Room: "Node_AA"},
+		{Timestamp: "1", Person: 2, Room: "Node_AA"},
+		{Timestamp: "1", Person: 3, Room: "Node_BB"},
+	} {
+		if _, err := tracker.Process(detection); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := httptest.NewServer(tracker.Handler())
+	defer server.Close()
+
+	get := func(path string, status int) Page {
+		response, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		if response.StatusCode != status {
+			t.Fatalf("GET %s returned %d, want %d", path, response.StatusCode, status)
+		}
+		var page Page
+		if status == http.StatusOK {
+			json.NewDecoder(response.Body).Decode(&page)
+		}
+		return page
+	}
+
+	tests := []struct {
+		path  string
+		total int
+		items int
+	}{
+		{"/rooms/Node_AA/occupants", 2, 2},
+		{"/rooms/Node_AA/occupants?offset=1&limit=5", 2, 1},
+		{"/rooms/Node_AA/history?limit=1", 2, 1},
+		{"/rooms/Node_CC/history", 0, 0},
+		{"/persons/3/history", 1, 1},
+		{"/persons/3/history?to=2000-01-01T00:00:00Z", 0, 0},
+		{"/alarms", 2, 2},
+		{"/alarms?offset=5", 2, 0},
+	}
+	for _, test := range tests {
+		page := get(test.path, http.StatusOK)
+		items, _ := page.Items.([]interface{})
+		if page.Total != test.total || len(items) != test.items {
+			t.Errorf("GET %s returned %d items of %d, want %d of %d", test.path, len(items), page.Total, test.items, test.total)
+		}
+	}
+
+	response, err := http.Get(server.URL + "/persons/3/location")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var location LocationStruct
+	json.NewDecoder(response.Body).Decode(&location)
+	response.Body.Close()
+	if location.Person != 3 || location.Location != "Node_BB" {
+		t.Errorf("Location of person 3 = %+v, want Node_BB", location)
+	}
+
+	get("/persons/9/location", http.StatusNotFound)
+	get("/persons/x/location", http.StatusBadRequest)
+	get("/rooms/Node_AA/history?from=yesterday", http.StatusBadRequest)
+	get("/alarms?limit=0", http.StatusBadRequest)
+	get("/unknown", http.StatusNotFound)
+}
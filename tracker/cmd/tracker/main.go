@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"os/user"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	datafusion "mainprocess/datafusion"
+	"mainprocess/metrics"
+	"mainprocess/tracker"
+	"mainprocess/transport"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var (
+	detectionListener transport.Handler = func(msg transport.Message) {
+		// The room is the node of the topic: /Nodes/<room>/Tracking/Detection
+		split := strings.Split(msg.Topic, "/")
+		if len(split) < 3 {
+			log.Errorf("[MQTT] Unexpected topic %s", msg.Topic)
+			return
+		}
+		room := split[2]
+
+		var detection tracker.Detection
+		err := json.Unmarshal(msg.Payload, &detection)
+		if err != nil {
+			log.Errorf("[MQTT] Invalid detection in %s: %v", room, err.Error())
+			return
+		}
+		detection.Room = room
+		log.Debugf("[MQTT] Detection in %s: %v", room, string(msg.Payload))
+		addToWindow(detection)
+	}
+
+	tailgatingListener transport.Handler = func(msg transport.Message) {
+		// The room is the node of the topic: /Nodes/<room>/Tracking/Tailgating
+		split := strings.Split(msg.Topic, "/")
+		if len(split) < 3 {
+			log.Errorf("[MQTT] Unexpected topic %s", msg.Topic)
+			return
+		}
+		room := split[2]
+
+		var analysis datafusion.Tailgating
+		err := json.Unmarshal(msg.Payload, &analysis)
+		if err != nil {
+			log.Errorf("[MQTT] Invalid tailgating analysis in %s: %v", room, err.Error())
+			return
+		}
+		_, _, err = locationTracker.Tailgating(room, analysis)
+		if err != nil {
+			log.Errorf("[Tracker] Unable to raise tailgating alarm in %s: %v", room, err.Error())
+		}
+	}
+
+	alarmAckListener transport.Handler = func(msg transport.Message) {
+		var request struct {
+			ID string `json:"id"`
+			By string `json:"by"`
+		}
+		err := json.Unmarshal(msg.Payload, &request)
+		if err != nil {
+			log.Errorf("[Alarm] Invalid acknowledge request: %v", err.Error())
+			return
+		}
+		_, err = locationTracker.Alarms().Acknowledge(request.ID, request.By)
+		if err != nil {
+			log.Errorf("[Alarm] Unable to acknowledge alarm: %v", err.Error())
+		}
+	}
+
+	alarmClearListener transport.Handler = func(msg transport.Message) {
+		var request struct {
+			ID string `json:"id"`
+		}
+		err := json.Unmarshal(msg.Payload, &request)
+		if err != nil {
+			log.Errorf("[Alarm] Invalid clear request: %v", err.Error())
+			return
+		}
+		_, err = locationTracker.Alarms().Clear(request.ID)
+		if err != nil {
+			log.Errorf("[Alarm] Unable to clear alarm: %v", err.Error())
+		}
+	}
+
+	mqttTransport   *transport.MQTT
+	trackerConfig   tracker.Config
+	locationTracker *tracker.Tracker
+
+	// Detections of each window waiting for the rest of the window
+	windowsMu sync.Mutex
+	windows   = make(map[string][]tracker.Detection)
+
+	// Detections published by the main process of every node
+	topicDetection = "/Nodes/+/Tracking/Detection"
+	// Tailgating analyses published by the main process of every node
+	topicTailgating = "/Nodes/+/Tracking/Tailgating"
+)
+
+// windowDelay is the time waited for the detections of a window, which are published one by one
+const windowDelay = 500 * time.Millisecond
+
+func init() {
+	log.SetLevel(log.DebugLevel)
+
+	readConfig()
+	viper.SetDefault("mqtt.server", "tcp://127.0.0.1:1883")
+	server := viper.GetString("mqtt.server")
+	viper.Set("mqtt.server", server)
+	viper.SetDefault("mqtt.trackerclientid", "tracker-client")
+	clientID := viper.GetString("mqtt.trackerclientid")
+	viper.Set("mqtt.trackerclientid", clientID)
+	viper.SetDefault("mqtt.keepAlive", 10)
+	keepAlive := viper.GetInt("mqtt.keepAlive")
+	viper.Set("mqtt.keepAlive", keepAlive)
+	viper.SetDefault("mqtt.pingTimeout", 1)
+	pingTimeout := viper.GetInt("mqtt.pingTimeout")
+	viper.Set("mqtt.pingTimeout", pingTimeout)
+	viper.WriteConfig()
+
+	mqttTransport = transport.NewMQTT(transport.MQTTConfig{
+		Server:      server,
+		ClientID:    clientID,
+		KeepAlive:   time.Duration(keepAlive) * time.Second,
+		PingTimeout: time.Duration(pingTimeout) * time.Second,
+	})
+
+	var err error
+	trackerConfig = tracker.ReadConfig()
+	locationTracker, err = tracker.New(trackerConfig, mqttTransport)
+	if err != nil {
+		log.Errorf(err.Error())
+		os.Exit(400)
+	}
+
+	viper.SetDefault("api.address", ":8080")
+	address := viper.GetString("api.address")
+	viper.Set("api.address", address)
+	viper.WriteConfig()
+	if address != "" {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			log.Errorf("Can't listen in %s: %v", address, err.Error())
+			os.Exit(400)
+		}
+		registry := metrics.NewRegistry()
+		locationTracker.RegisterMetrics(registry)
+		mux := http.NewServeMux()
+		mux.Handle("/api/", http.StripPrefix("/api", locationTracker.Handler()))
+		mux.Handle("/metrics", registry.Handler())
+		go func() {
+			log.Errorf("[API] %v", http.Serve(listener, mux))
+		}()
+		log.Infof("[API] Serving the tracker API in %s/api and the metrics in %s/metrics", address, address)
+	}
+
+	// The subscriptions are done once connected
+	err = subscribeToTopics()
+	if err != nil {
+		log.Errorf(err.Error())
+		os.Exit(400)
+	}
+	err = mqttTransport.Connect()
+	if err != nil {
+		log.Errorf(err.Error())
+		os.Exit(400)
+	}
+}
+
+func readConfig() {
+	userDir, err := user.Current()
+	if err != nil {
+		log.Errorf(err.Error())
+	}
+
+	configDir := path.Join(userDir.HomeDir, ".config", "ml-system")
+	_, err = os.Stat(configDir)
+	if os.IsNotExist(err) {
+		errDir := os.MkdirAll(configDir, 0755)
+		if errDir != nil {
+			log.Errorf(err.Error())
+		}
+	}
+
+	cfgFileDir := path.Join(configDir, "config.toml")
+	file, err := os.OpenFile(cfgFileDir, os.O_CREATE|os.O_WRONLY, 0755)
+	if err != nil {
+		log.Errorf(err.Error())
+	}
+	err = file.Close()
+	if err != nil {
+		log.Errorf(err.Error())
+	}
+	viper.SetConfigFile(cfgFileDir)
+	if err := viper.ReadInConfig(); err != nil {
+		log.Errorf("[Init] Unable to read config from file %s: %s", cfgFileDir, err.Error())
+	} else {
+		log.Infof("[Init] Read configuration from file %s", cfgFileDir)
+	}
+}
+
+func subscribeToTopics() error {
+	err := mqttTransport.Subscribe(topicDetection, detectionListener)
+	if err != nil {
+		return err
+	}
+	err = mqttTransport.Subscribe(topicTailgating, tailgatingListener)
+	if err != nil {
+		return err
+	}
+	err = mqttTransport.Subscribe(trackerConfig.AlarmClearTopic, alarmClearListener)
+	if err != nil {
+		return err
+	}
+	return mqttTransport.Subscribe(trackerConfig.AlarmAckTopic, alarmAckListener)
+}
+
+// addToWindow keeps the detection until the rest of the detections of its window arrive, so the
+// window is processed together. Detections without window are processed alone
+func addToWindow(detection tracker.Detection) {
+	if detection.Window == "" {
+		_, err := locationTracker.Process(detection)
+		if err != nil {
+			log.Errorf("[Tracker] Unable to process detection of user %d: %v", detection.Person, err.Error())
+		}
+		return
+	}
+
+	windowsMu.Lock()
+	defer windowsMu.Unlock()
+	if _, ok := windows[detection.Window]; !ok {
+		window := detection.Window
+		time.AfterFunc(windowDelay, func() {
+			processWindow(window)
+		})
+	}
+	windows[detection.Window] = append(windows[detection.Window], detection)
+}
+
+func processWindow(window string) {
+	windowsMu.Lock()
+	detections := windows[window]
+	delete(windows, window)
+	windowsMu.Unlock()
+
+	_, err := locationTracker.ProcessWindow(detections)
+	if err != nil {
+		log.Errorf("[Tracker] Unable to process detections of window %s: %v", window, err.Error())
+	}
+}
+
+// flushWindows processes the detections of every window without waiting for the rest of the window
+func flushWindows() {
+	windowsMu.Lock()
+	pending := make([]string, 0, len(windows))
+	for window := range windows {
+		pending = append(pending, window)
+	}
+	windowsMu.Unlock()
+
+	for _, window := range pending {
+		processWindow(window)
+	}
+}
+
+func main() {
+	log.Infof("[Tracker] Waiting for detections in %s", topicDetection)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	received := <-signals
+	log.Infof("[Shutdown] Received %v, stopping", received)
+
+	// No more detections are received, so the pending windows can be processed before closing the tracker
+	err := mqttTransport.Unsubscribe(topicDetection, topicTailgating, trackerConfig.AlarmClearTopic, trackerConfig.AlarmAckTopic)
+	if err != nil {
+		log.Warnf("[MQTT] Unable to unsubscribe: %v", err.Error())
+	}
+	flushWindows()
+	mqttTransport.Close()
+	err = locationTracker.Close()
+	if err != nil {
+		log.Errorf(err.Error())
+		os.Exit(400)
+	}
+	log.Infof("[Shutdown] Stopped")
+}
@@ -0,0 +1,277 @@
+package tracker
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// NotifyTier has the notification sinks of a tier. Empty values disable the sink
+type NotifyTier struct {
+	Webhook string
+	// Mail has the recipients of the mails
+	Mail      []string
+	MQTTTopic string
+	File      string
+}
+
+// NotifyConfig has the settings of the alarm notifications
+type NotifyConfig struct {
+	Tiers         [2]NotifyTier
+	Retries       int
+	Backoff       time.Duration
+	EscalateAfter time.Duration
+	MailServer    string
+	MailFrom      string
+	// FileMaxSize is the size in bytes at which the notification files are rotated
+	FileMaxSize  int64
+	FileMaxFiles int
+}
+
+// Config has the settings of the tracker, shared by every process running it
+type Config struct {
+	PermissionsFile   string
+	AlarmTopic        string
+	AlarmClearTopic   string
+	AlarmAckTopic     string
+	AlarmCooldown     time.Duration
+	Storage           string
+	StoragePath       string
+	ChangeCounter     int
+	ChangeCounterRfid float64
+	ChangeCounterWifi float64
+	// OccupancyTopic is the topic format, with the room, where the occupancy of each room is published
+	OccupancyTopic string
+	// OccupancyTimeout is the time after which a person not detected anymore leaves the room
+	OccupancyTimeout time.Duration
+	// Capacities has the maximum number of persons of each room
+	Capacities map[string]int
+	// RetentionDays is the number of days the locations are kept, 0 to keep them forever
+	RetentionDays   int
+	RetentionPolicy string
+	// AggregateFile has the aggregates of the locations removed with the aggregate policy
+	AggregateFile string
+	// AuditFile has an entry for each erasure of the locations of a person
+	AuditFile string
+	Notify    NotifyConfig
+	// EscortTimeout is the time an escorted person can be alone before raising an alarm
+	EscortTimeout time.Duration
+	// TopologyFile has the rooms of the building, used to find impossible movements
+	TopologyFile string
+	AnomalyTopic string
+}
+
+// ReadConfig reads the settings of the tracker, storing the default values in the configuration file
+func ReadConfig() Config {
+	var config Config
+	viper.SetDefault("tracker.permissionsFile", "")
+	config.PermissionsFile = viper.GetString("tracker.permissionsFile")
+	viper.Set("tracker.permissionsFile", config.PermissionsFile)
+	viper.SetDefault("tracker.alarmTopic", "/Tracking/Alarms")
+	config.AlarmTopic = viper.GetString("tracker.alarmTopic")
+	viper.Set("tracker.alarmTopic", config.AlarmTopic)
+	viper.SetDefault("tracker.alarmClearTopic", "/Tracking/Alarms/Clear")
+	config.AlarmClearTopic = viper.GetString("tracker.alarmClearTopic")
+	viper.Set("tracker.alarmClearTopic", config.AlarmClearTopic)
+	viper.SetDefault("tracker.alarmAckTopic", "/Tracking/Alarms/Ack")
+	config.AlarmAckTopic = viper.GetString("tracker.alarmAckTopic")
+	viper.Set("tracker.alarmAckTopic", config.AlarmAckTopic)
+	viper.SetDefault("tracker.alarmCooldown", 60)
+	alarmCooldown := viper.GetInt("tracker.alarmCooldown")
+	config.AlarmCooldown = time.Duration(alarmCooldown) * time.Second
+	viper.Set("tracker.alarmCooldown", alarmCooldown)
+	viper.SetDefault("tracker.storage", StorageBolt)
+	config.Storage = viper.GetString("tracker.storage")
+	viper.Set("tracker.storage", config.Storage)
+	viper.SetDefault("tracker.storagePath", "./data/locations.db")
+	config.StoragePath = viper.GetString("tracker.storagePath")
+	viper.Set("tracker.storagePath", config.StoragePath)
+	viper.SetDefault("positioning.changeCounter", 3)
+	config.ChangeCounter = viper.GetInt("positioning.changeCounter")
+	viper.Set("positioning.changeCounter", config.ChangeCounter)
+	viper.SetDefault("positioning.changeCounterRfid", 5.0)
+	config.ChangeCounterRfid = viper.GetFloat64("positioning.changeCounterRfid")
+	viper.Set("positioning.changeCounterRfid", config.ChangeCounterRfid)
+	viper.SetDefault("positioning.changeCounterWifi", 5.0)
+	config.ChangeCounterWifi = viper.GetFloat64("positioning.changeCounterWifi")
+	viper.Set("positioning.changeCounterWifi", config.ChangeCounterWifi)
+	viper.SetDefault("tracker.occupancyTopic", "/Nodes/%v/Tracking/Occupancy")
+	config.OccupancyTopic = viper.GetString("tracker.occupancyTopic")
+	viper.Set("tracker.occupancyTopic", config.OccupancyTopic)
+	viper.SetDefault("tracker.occupancyTimeout", 300)
+	occupancyTimeout := viper.GetInt("tracker.occupancyTimeout")
+	config.OccupancyTimeout = time.Duration(occupancyTimeout) * time.Second
+	viper.Set("tracker.occupancyTimeout", occupancyTimeout)
+	config.Capacities = make(map[string]int)
+	for room, value := range viper.GetStringMapString("tracker.capacities") {
+		capacity, err := strconv.Atoi(value)
+		if err != nil {
+			log.Errorf("[Init] Invalid capacity %s of room %s", value, room)
+			continue
+		}
+		config.Capacities[room] = capacity
+	}
+	viper.SetDefault("tracker.retentionDays", 0)
+	config.RetentionDays = viper.GetInt("tracker.retentionDays")
+	viper.Set("tracker.retentionDays", config.RetentionDays)
+	viper.SetDefault("tracker.retentionPolicy", RetentionDelete)
+	config.RetentionPolicy = viper.GetString("tracker.retentionPolicy")
+	viper.Set("tracker.retentionPolicy", config.RetentionPolicy)
+	viper.SetDefault("tracker.aggregateFile", "./data/locations.aggregate.jsonl")
+	config.AggregateFile = viper.GetString("tracker.aggregateFile")
+	viper.Set("tracker.aggregateFile", config.AggregateFile)
+	viper.SetDefault("tracker.auditFile", "./data/audit.jsonl")
+	config.AuditFile = viper.GetString("tracker.auditFile")
+	viper.Set("tracker.auditFile", config.AuditFile)
+	viper.SetDefault("tracker.escortTimeout", 30)
+	escortTimeout := viper.GetInt("tracker.escortTimeout")
+	config.EscortTimeout = time.Duration(escortTimeout) * time.Second
+	viper.Set("tracker.escortTimeout", escortTimeout)
+	viper.SetDefault("tracker.topologyFile", "")
+	config.TopologyFile = viper.GetString("tracker.topologyFile")
+	viper.Set("tracker.topologyFile", config.TopologyFile)
+	viper.SetDefault("tracker.anomalyTopic", "/Tracking/Anomalies")
+	config.AnomalyTopic = viper.GetString("tracker.anomalyTopic")
+	viper.Set("tracker.anomalyTopic", config.AnomalyTopic)
+	config.Notify = readNotifyConfig()
+	viper.WriteConfig()
+	return config
+}
+
+func readNotifyConfig() NotifyConfig {
+	var config NotifyConfig
+	for i := range config.Tiers {
+		prefix := fmt.Sprintf("notify.tier%d.", i+1)
+		viper.SetDefault(prefix+"webhook", "")
+		config.Tiers[i].Webhook = viper.GetString(prefix + "webhook")
+		viper.Set(prefix+"webhook", config.Tiers[i].Webhook)
+		viper.SetDefault(prefix+"mail", []string{})
+		config.Tiers[i].Mail = viper.GetStringSlice(prefix + "mail")
+		viper.Set(prefix+"mail", config.Tiers[i].Mail)
+		viper.SetDefault(prefix+"mqttTopic", "")
+		config.Tiers[i].MQTTTopic = viper.GetString(prefix + "mqttTopic")
+		viper.Set(prefix+"mqttTopic", config.Tiers[i].MQTTTopic)
+		viper.SetDefault(prefix+"file", "")
+		config.Tiers[i].File = viper.GetString(prefix + "file")
+		viper.Set(prefix+"file", config.Tiers[i].File)
+	}
+	viper.SetDefault("notify.retries", 3)
+	config.Retries = viper.GetInt("notify.retries")
+	viper.Set("notify.retries", config.Retries)
+	viper.SetDefault("notify.backoff", 2)
+	backoff := viper.GetInt("notify.backoff")
+	config.Backoff = time.Duration(backoff) * time.Second
+	viper.Set("notify.backoff", backoff)
+	viper.SetDefault("notify.escalateAfter", 10)
+	escalateAfter := viper.GetInt("notify.escalateAfter")
+	config.EscalateAfter = time.Duration(escalateAfter) * time.Minute
+	viper.Set("notify.escalateAfter", escalateAfter)
+	viper.SetDefault("notify.mailServer", "127.0.0.1:25")
+	config.MailServer = viper.GetString("notify.mailServer")
+	viper.Set("notify.mailServer", config.MailServer)
+	viper.SetDefault("notify.mailFrom", "tracker@localhost")
+	config.MailFrom = viper.GetString("notify.mailFrom")
+	viper.Set("notify.mailFrom", config.MailFrom)
+	viper.SetDefault("notify.fileMaxSize", 10)
+	fileMaxSize := viper.GetInt64("notify.fileMaxSize")
+	config.FileMaxSize = fileMaxSize * 1024 * 1024
+	viper.Set("notify.fileMaxSize", fileMaxSize)
+	viper.SetDefault("notify.fileMaxFiles", 5)
+	config.FileMaxFiles = viper.GetInt("notify.fileMaxFiles")
+	viper.Set("notify.fileMaxFiles", config.FileMaxFiles)
+	return config
+}
+
+// NewNotifierFromConfig creates the notification sinks of each tier. Returns nil when there are no sinks
+func NewNotifierFromConfig(config NotifyConfig, publisher Publisher) *Notifier {
+	var tiers [2][]Sink
+	for i, tier := range config.Tiers {
+		if tier.Webhook != "" {
+			tiers[i] = append(tiers[i], NewWebhookSink(tier.Webhook, 10*time.Second))
+		}
+		if len(tier.Mail) > 0 {
+			tiers[i] = append(tiers[i], &MailSink{Server: config.MailServer, From: config.MailFrom, To: tier.Mail})
+		}
+		if tier.MQTTTopic != "" && publisher != nil {
+			tiers[i] = append(tiers[i], &MQTTSink{Publisher: publisher, Topic: tier.MQTTTopic})
+		}
+		if tier.File != "" {
+			tiers[i] = append(tiers[i], &FileSink{Path: tier.File, MaxSize: config.FileMaxSize, MaxFiles: config.FileMaxFiles})
+		}
+	}
+	if len(tiers[0]) == 0 && len(tiers[1]) == 0 {
+		return nil
+	}
+	return NewNotifier(tiers[0], tiers[1], config.Retries, config.Backoff, config.EscalateAfter)
+}
+
+// New creates a tracker opening the storage, creating the alarm manager publishing with the publisher
+// and loading the permission rules of the configuration
+func New(config Config, publisher Publisher) (*Tracker, error) {
+	if config.RetentionDays > 0 && config.RetentionPolicy != RetentionDelete && config.RetentionPolicy != RetentionAggregate {
+		return nil, fmt.Errorf("Unknown retention policy %s", config.RetentionPolicy)
+	}
+	var movements *movementChecker
+	if config.TopologyFile != "" {
+		topology, err := LoadTopology(config.TopologyFile)
+		if err != nil {
+			return nil, err
+		}
+		movements = newMovementChecker(topology)
+	}
+	locationStore, err := OpenLocationStore(config.Storage, config.StoragePath)
+	if err != nil {
+		return nil, fmt.Errorf("Can't open location store %s: %v", config.StoragePath, err.Error())
+	}
+	t := &Tracker{
+		config:    config,
+		publisher: publisher,
+		alarms:    NewAlarmManager(publisher, config.AlarmTopic, config.AlarmCooldown, NewNotifierFromConfig(config.Notify, publisher)),
+		store:     locationStore,
+		positions: newPositionTracker(locationStore),
+		occupancy: newOccupancy(config.Capacities, config.OccupancyTimeout),
+		movements: movements,
+		done:      make(chan struct{}),
+		escorted:  make(map[int]escortState),
+	}
+
+	if config.PermissionsFile == "" {
+		log.Warnf("[Init] No permissions file configured, every person is allowed in every room")
+	} else {
+		t.permissions, err = LoadPermissions(config.PermissionsFile)
+		if err != nil {
+			locationStore.Close()
+			return nil, err
+		}
+		err = t.permissions.Watch()
+		if err != nil {
+			locationStore.Close()
+			return nil, err
+		}
+	}
+
+	// The background tasks are started once nothing else can fail, so they never outlive a failed New
+	if config.OccupancyTimeout > 0 {
+		go t.expireOccupants()
+	}
+	if config.RetentionDays > 0 {
+		go t.applyRetention()
+	}
+	return t, nil
+}
+
+// Close stops watching the permissions file and the occupancy of the rooms, waits for the
+// notifications being sent and closes the storage
+func (t *Tracker) Close() error {
+	close(t.done)
+	if t.permissions != nil {
+		t.permissions.Close()
+	}
+	if t.alarms.notifier != nil {
+		t.alarms.notifier.Close()
+	}
+	return t.store.Close()
+}
@@ -0,0 +1,95 @@
+package tracker
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Actions of the erasure audit entries
+const (
+	AuditErase        = "erase"
+	AuditPseudonymize = "pseudonymize"
+)
+
+// AuditEntry records an erasure of the locations of a person. The pseudonym is never written, so
+// the pseudonymized locations can't be linked back to the person
+type AuditEntry struct {
+	Timestamp string `json:"timestamp"`
+	Action    string `json:"action"`
+	Person    int    `json:"person"`
+	Records   int    `json:"records"`
+	Operator  string `json:"operator"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ErasePerson removes every stored location of a person, or replaces the person with a random
+// negative pseudonym, and appends an entry to the audit file
+func ErasePerson(store LocationStore, person int, pseudonymize bool, operator, reason, auditFile string) (AuditEntry, error) {
+	entry := AuditEntry{
+		Action:   AuditErase,
+		Person:   person,
+		Operator: operator,
+		Reason:   reason,
+	}
+	query := LocationQuery{Person: &person}
+
+	var err error
+	if pseudonymize {
+		entry.Action = AuditPseudonymize
+		var pseudonym int
+		pseudonym, err = newPseudonym()
+		if err != nil {
+			return entry, err
+		}
+		entry.Records, err = store.Rewrite(query, func(record LocationStruct) LocationStruct {
+			record.Person = pseudonym
+			return record
+		})
+	} else {
+		entry.Records, err = store.Delete(query)
+	}
+	if err != nil {
+		return entry, fmt.Errorf("Can't %s locations of user %d: %v", entry.Action, person, err.Error())
+	}
+
+	entry.Timestamp = time.Now().Format(time.RFC3339)
+	err = appendAudit(auditFile, entry)
+	if err != nil {
+		return entry, fmt.Errorf("Locations of user %d changed, but the audit entry couldn't be written to %s: %v", person, auditFile, err.Error())
+	}
+	log.Infof("[Erasure] %s %d locations of user %d by %s", entry.Action, entry.Records, person, operator)
+	return entry, nil
+}
+
+// newPseudonym returns a random negative person ID, which never collides with the real IDs
+func newPseudonym() (int, error) {
+	b := make([]byte, 4)
+	_, err := rand.Read(b)
+	if err != nil {
+		return 0, err
+	}
+	return -int(binary.BigEndian.Uint32(b)&0x7fffffff) - 1, nil
+}
+
+func appendAudit(file string, entry AuditEntry) error {
+	byteData, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(byteData, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
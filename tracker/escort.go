@@ -0,0 +1,61 @@
+package tracker
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// escortState is the last time an unauthorized person was detected with an escort in a room
+type escortState struct {
+	room string
+	seen time.Time
+}
+
+// applyEscorts changes the decisions of the unauthorized persons detected in the same room as a person
+// allowed to escort them. An escorted person detected alone keeps being escorted during the escort
+// timeout, and raises an alarm after it. Denied persons are never escorted
+func (t *Tracker) applyEscorts(detections []Detection, decisions []Decision) {
+	escorts := make(map[string][]int)
+	for i, detection := range detections {
+		if decisions[i].Allowed && decisions[i].Escort {
+			escorts[detection.Room] = append(escorts[detection.Room], detection.Person)
+		}
+	}
+
+	t.escortMu.Lock()
+	defer t.escortMu.Unlock()
+	for i, detection := range detections {
+		decision := &decisions[i]
+		if decision.Allowed || decision.Denied || detection.Room == "" {
+			continue
+		}
+		at := detectionTime(detection.Timestamp)
+		if len(escorts[detection.Room]) > 0 {
+			decision.Escorted = true
+			decision.Reason = fmt.Sprintf("escorted by user %d", escorts[detection.Room][0])
+			t.escorted[detection.Person] = escortState{room: detection.Room, seen: at}
+			continue
+		}
+
+		state, ok := t.escorted[detection.Person]
+		if !ok {
+			continue
+		}
+		if state.room != detection.Room {
+			// The person left the escorted room alone, so the rules of the new room apply
+			delete(t.escorted, detection.Person)
+			continue
+		}
+		alone := at.Sub(state.seen)
+		if alone <= t.config.EscortTimeout {
+			decision.Escorted = true
+			decision.Reason = fmt.Sprintf("escorted, alone for %v", alone.Round(time.Second))
+			continue
+		}
+		log.Warnf("[Tracker] Escorted user %d alone in room %s for %v", detection.Person, detection.Room, alone.Round(time.Second))
+		decision.Reason = fmt.Sprintf("escorted person alone for more than %v", t.config.EscortTimeout)
+		delete(t.escorted, detection.Person)
+	}
+}
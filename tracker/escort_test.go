@@ -0,0 +1,90 @@
+package tracker
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEscortWindow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := testConfig(t, dir)
+	config.PermissionsFile = writeFile(t, dir, "permissions.yaml", `
+rules:
+  - persons: [1]
+    rooms: [Node_AA, Node_BB]
+    escort: true
+  - persons: [4]
+    rooms: [Node_AA]
+  - deny: true
+    persons: [3]
+    rooms: [Node_AA]
+`)
+	config.EscortTimeout = 30 * time.Second
+	tracker, err := New(config, &testPublisher{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	at := func(seconds int) string {
+		return start.Add(time.Duration(seconds) * time.Second).Format(time.RFC3339)
+	}
+	window := func(detections ...Detection) []Result {
+		results, err := tracker.ProcessWindow(detections)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	// The escort covers the unauthorized person, but not the denied one
+	results := window(
+		Detection{Timestamp: at(0), Person: 1, Room: "Node_AA"},
+		Detection{Timestamp: at(0), Person: 2, Room: "Node_AA"},
+		Detection{Timestamp: at(0), Person: 3, Room: "Node_AA"},
+	)
+	if !results[0].Decision.Escort || results[0].Alarm != nil {
+		t.Errorf("Result of the escort = %+v, want allowed to escort", results[0])
+	}
+	if !results[1].Decision.Escorted || results[1].Alarm != nil {
+		t.Errorf("Result of the escorted person = %+v, want escorted without alarm", results[1])
+	}
+	if results[2].Decision.Escorted || results[2].Alarm == nil || results[2].Alarm.Severity != SeverityCritical {
+		t.Errorf("Result of the denied person = %+v, want a critical alarm", results[2])
+	}
+
+	// An allowed person without escort rule doesn't escort
+	results = window(
+		Detection{Timestamp: at(0), Person: 4, Room: "Node_AA"},
+		Detection{Timestamp: at(0), Person: 5, Room: "Node_AA"},
+	)
+	if results[1].Decision.Escorted || results[1].Alarm == nil {
+		t.Errorf("Result of a person with a non escort = %+v, want an alarm", results[1])
+	}
+
+	// Alone during the timeout the person is still escorted, and raises an alarm after it
+	if results := window(Detection{Timestamp: at(20), Person: 2, Room: "Node_AA"}); !results[0].Decision.Escorted || results[0].Alarm != nil {
+		t.Errorf("Result of the person alone during the timeout = %+v, want escorted", results[0])
+	}
+	results = window(Detection{Timestamp: at(31), Person: 2, Room: "Node_AA"})
+	if results[0].Decision.Escorted || results[0].Alarm == nil {
+		t.Errorf("Result of the person alone after the timeout = %+v, want an alarm", results[0])
+	}
+
+	// Leaving the escorted room alone applies the rules of the new room
+	window(
+		Detection{Timestamp: at(40), Person: 1, Room: "Node_BB"},
+		Detection{Timestamp: at(40), Person: 6, Room: "Node_BB"},
+	)
+	results = window(Detection{Timestamp: at(45), Person: 6, Room: "Node_CC"})
+	if results[0].Decision.Escorted || results[0].Alarm == nil {
+		t.Errorf("Result of the person leaving the escort = %+v, want an alarm", results[0])
+	}
+}
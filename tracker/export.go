@@ -0,0 +1,56 @@
+package tracker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Formats of the exported locations
+const (
+	ExportCSV   = "csv"
+	ExportJSONL = "jsonl"
+)
+
+// Export writes the stored locations matching the query in CSV or JSON lines. Returns the number of
+// locations written
+func Export(store LocationStore, query LocationQuery, format string, w io.Writer) (int, error) {
+	if format != ExportCSV && format != ExportJSONL {
+		return 0, fmt.Errorf("Unknown export format %s", format)
+	}
+	records, err := store.Query(query)
+	if err != nil {
+		return 0, err
+	}
+
+	if format == ExportJSONL {
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			err = encoder.Encode(record)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return len(records), nil
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"recorded", "timestamp", "person", "location", "alarm", "rfid", "wifi", "counter"})
+	for _, record := range records {
+		writer.Write([]string{
+			record.Recorded.Format(time.RFC3339Nano),
+			record.Timestamp,
+			strconv.Itoa(record.Person),
+			record.Location,
+			strconv.FormatBool(record.Alarm),
+			strconv.FormatFloat(record.Rfid, 'f', -1, 64),
+			strconv.FormatFloat(record.Wifi, 'f', -1, 64),
+			strconv.Itoa(record.Counter),
+		})
+	}
+	writer.Flush()
+	return len(records), writer.Error()
+}
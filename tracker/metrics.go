@@ -0,0 +1,35 @@
+package tracker
+
+import (
+	"mainprocess/metrics"
+)
+
+// RegisterMetrics adds the counters of the tracker to a metrics registry. They are read from
+// Stats and the alarm manager when the metrics are written
+func (t *Tracker) RegisterMetrics(registry *metrics.Registry) {
+	counters := []struct {
+		name  string
+		help  string
+		value func(Stats) uint64
+	}{
+		{"mainprocess_tracker_detections_total", "Detections processed by the tracker.", func(s Stats) uint64 { return s.Detections }},
+		{"mainprocess_tracker_errors_total", "Detections that couldn't be fully processed by the tracker.", func(s Stats) uint64 { return s.Errors }},
+		{"mainprocess_tracker_alarms_total", "Permission alarms raised, or published again after the cooldown.", func(s Stats) uint64 { return s.Alarms }},
+		{"mainprocess_tracker_stored_total", "Location changes stored by the tracker.", func(s Stats) uint64 { return s.Stored }},
+		{"mainprocess_tracker_anomalies_total", "Impossible movements detected by the tracker.", func(s Stats) uint64 { return s.Anomalies }},
+	}
+	for _, counter := range counters {
+		value := counter.value
+		registry.Func(counter.name, counter.help, metrics.TypeCounter, nil, func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(value(t.Stats()))}}
+		})
+	}
+
+	registry.Func("mainprocess_alarms_total", "Alarms raised by the tracker.", metrics.TypeCounter, []string{"kind"}, func() []metrics.Sample {
+		var samples []metrics.Sample
+		for kind, count := range t.alarms.Raised() {
+			samples = append(samples, metrics.Sample{LabelValues: []string{kind}, Value: float64(count)})
+		}
+		return samples
+	})
+}
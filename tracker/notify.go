@@ -0,0 +1,160 @@
+package tracker
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Events of the alarm notifications
+const (
+	NotifyRaised    = "raised"
+	NotifyEscalated = "escalated"
+	NotifyCleared   = "cleared"
+)
+
+type (
+	// Notification is sent to the sinks when an alarm is raised, escalated or cleared
+	Notification struct {
+		Event string `json:"event"`
+		// Tier is 1 for the first notification and 2 for the escalation
+		Tier  int   `json:"tier"`
+		Alarm Alarm `json:"alarm"`
+	}
+
+	// Sink delivers the notifications of the alarms to the people that handle them
+	Sink interface {
+		Name() string
+		Notify(notification Notification) error
+	}
+
+	// Notifier sends the alarms to the sinks of the first tier, and to the sinks of the second tier
+	// when they aren't acknowledged in time. Each sink is retried with an exponential backoff
+	Notifier struct {
+		tiers         [2][]Sink
+		retries       int
+		backoff       time.Duration
+		escalateAfter time.Duration
+
+		mu     sync.Mutex
+		timers map[string]*time.Timer
+		closed bool
+		// done is closed by Close to cancel the retries waiting for their backoff
+		done chan struct{}
+		// deliveries waits for the notifications being delivered
+		deliveries sync.WaitGroup
+	}
+)
+
+// NewNotifier creates a notifier with the sinks of the first and second tier. Each sink is tried
+// retries more times after a failure, waiting backoff and doubling it each time. When escalateAfter
+// is 0 the alarms are never escalated
+func NewNotifier(tier1, tier2 []Sink, retries int, backoff, escalateAfter time.Duration) *Notifier {
+	return &Notifier{
+		tiers:         [2][]Sink{tier1, tier2},
+		retries:       retries,
+		backoff:       backoff,
+		escalateAfter: escalateAfter,
+		timers:        make(map[string]*time.Timer),
+		done:          make(chan struct{}),
+	}
+}
+
+// Close stops the escalations, cancels the retries and waits for the notifications being sent.
+// The alarms raised after closing aren't notified
+func (n *Notifier) Close() {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return
+	}
+	n.closed = true
+	close(n.done)
+	for id, timer := range n.timers {
+		timer.Stop()
+		delete(n.timers, id)
+	}
+	n.mu.Unlock()
+	n.deliveries.Wait()
+}
+
+// raised notifies the first tier about an alarm. New alarms are escalated after the delay if
+// pending still returns them, which happens while they are open and not acknowledged
+func (n *Notifier) raised(alarm Alarm, isNew bool, pending func(id string) (Alarm, bool)) {
+	n.send(Notification{Event: NotifyRaised, Tier: 1, Alarm: alarm})
+	if !isNew || n.escalateAfter <= 0 || len(n.tiers[1]) == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	n.timers[alarm.ID] = time.AfterFunc(n.escalateAfter, func() {
+		n.mu.Lock()
+		delete(n.timers, alarm.ID)
+		n.mu.Unlock()
+		current, ok := pending(alarm.ID)
+		if !ok {
+			return
+		}
+		log.Warnf("[Notify] Alarm %s not acknowledged after %v, escalating", current.ID, n.escalateAfter)
+		n.send(Notification{Event: NotifyEscalated, Tier: 2, Alarm: current})
+	})
+}
+
+// acknowledged stops the escalation of an alarm
+func (n *Notifier) acknowledged(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if timer, ok := n.timers[id]; ok {
+		timer.Stop()
+		delete(n.timers, id)
+	}
+}
+
+// cleared stops the escalation of an alarm and notifies the first tier
+func (n *Notifier) cleared(alarm Alarm) {
+	n.acknowledged(alarm.ID)
+	n.send(Notification{Event: NotifyCleared, Tier: 1, Alarm: alarm})
+}
+
+// send delivers the notification to every sink of its tier in background, unless the notifier is closed
+func (n *Notifier) send(notification Notification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		log.Warnf("[Notify] Notifier closed, alarm %s %s not sent", notification.Alarm.ID, notification.Event)
+		return
+	}
+	for _, sink := range n.tiers[notification.Tier-1] {
+		n.deliveries.Add(1)
+		go n.deliver(sink, notification)
+	}
+}
+
+func (n *Notifier) deliver(sink Sink, notification Notification) {
+	defer n.deliveries.Done()
+	backoff := n.backoff
+	var err error
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-n.done:
+				log.Errorf("[Notify] Notifier closed, alarm %s %s not sent to %s: %v", notification.Alarm.ID, notification.Event, sink.Name(), err.Error())
+				return
+			}
+			backoff *= 2
+		}
+		err = sink.Notify(notification)
+		if err == nil {
+			log.Debugf("[Notify] Alarm %s %s sent to %s", notification.Alarm.ID, notification.Event, sink.Name())
+			return
+		}
+		log.Warnf("[Notify] Attempt %d/%d of %s failed: %v", attempt+1, n.retries+1, sink.Name(), err.Error())
+	}
+	log.Errorf("[Notify] Alarm %s %s not sent to %s: %v", notification.Alarm.ID, notification.Event, sink.Name(), err.Error())
+}
@@ -0,0 +1,249 @@
+package tracker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookServer records the notifications received, failing the first requests
+type webhookServer struct {
+	*httptest.Server
+	failures int
+
+	mu            sync.Mutex
+	requests      int
+	notifications chan Notification
+}
+
+func newWebhookServer(failures int) *webhookServer {
+	s := &webhookServer{failures: failures, notifications: make(chan Notification, 10)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		fail := s.requests <= s.failures
+		s.mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var notification Notification
+		json.NewDecoder(r.Body).Decode(&notification)
+		s.notifications <- notification
+	}))
+	return s
+}
+
+func (s *webhookServer) receive(t *testing.T) Notification {
+	t.Helper()
+	select {
+	case notification := <-s.notifications:
+		return notification
+	case <-time.After(2 * time.Second):
+		t.Fatal("No notification received")
+		return Notification{}
+	}
+}
+
+// smtpServer is a fake SMTP server that sends the data of each mail to a channel
+type smtpServer struct {
+	listener net.Listener
+	mails    chan string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: listener, mails: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "220 localhost ESMTP\r\n")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			fmt.Fprintf(conn, "250 localhost\r\n")
+		case command == "DATA":
+			fmt.Fprintf(conn, "354 End data with <CR><LF>.<CR><LF>\r\n")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.mails <- data.String()
+			fmt.Fprintf(conn, "250 OK\r\n")
+		case command == "QUIT":
+			fmt.Fprintf(conn, "221 Bye\r\n")
+			return
+		default:
+			fmt.Fprintf(conn, "250 OK\r\n")
+		}
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	webhook := newWebhookServer(2)
+	defer webhook.Close()
+	notifier := NewNotifier([]Sink{NewWebhookSink(webhook.URL, time.Second)}, nil, 2, 10*time.Millisecond, 0)
+	alarms := NewAlarmManager(nil, "", time.Minute, notifier)
+
+	alarm, _, err := alarms.Raise(Alarm{Person: 1, Room: "Node_AA", Severity: SeverityWarning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notification := webhook.receive(t)
+	if notification.Event != NotifyRaised || notification.Alarm.ID != alarm.ID {
+		t.Errorf("Notification = %s of %s, want %s of %s", notification.Event, notification.Alarm.ID, NotifyRaised, alarm.ID)
+	}
+	webhook.mu.Lock()
+	defer webhook.mu.Unlock()
+	if webhook.requests != 3 {
+		t.Errorf("Requests = %d, want 3", webhook.requests)
+	}
+}
+
+func TestEscalation(t *testing.T) {
+	webhook := newWebhookServer(0)
+	defer webhook.Close()
+	mail := newSMTPServer(t)
+	defer mail.listener.Close()
+	tier2 := []Sink{&MailSink{Server: mail.listener.Addr().String(), From: "tracker@example.com", To: []string{"security@example.com"}}}
+	notifier := NewNotifier([]Sink{NewWebhookSink(webhook.URL, time.Second)}, tier2, 0, 0, 100*time.Millisecond)
+	alarms := NewAlarmManager(nil, "", time.Minute, notifier)
+
+	escalated, _, err := alarms.Raise(Alarm{Person: 1, Room: "Node_AA", Severity: SeverityCritical})
+	if err != nil {
+		t.Fatal(err)
+	}
+	acknowledged, _, err := alarms.Raise(Alarm{Person: 2, Room: "Node_AA", Severity: SeverityWarning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = alarms.Acknowledge(acknowledged.ID, "operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook.receive(t)
+	webhook.receive(t)
+
+	select {
+	case data := <-mail.mails:
+		if !strings.Contains(data, "alarm escalated") || !strings.Contains(data, escalated.ID) {
+			t.Errorf("Mail isn't the escalation of %s:\n%s", escalated.ID, data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Alarm not escalated")
+	}
+	select {
+	case data := <-mail.mails:
+		t.Errorf("Acknowledged alarm escalated:\n%s", data)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+// blockingPublisher blocks every publication until it's released
+type blockingPublisher struct {
+	release chan struct{}
+}
+
+func (p *blockingPublisher) Publish(topic string, payload []byte) error {
+	<-p.release
+	return nil
+}
+
+func TestRaiseDoesNotBlockOtherAlarms(t *testing.T) {
+	publisher := &blockingPublisher{release: make(chan struct{})}
+	defer close(publisher.release)
+	alarms := NewAlarmManager(publisher, "/alarms", time.Minute, nil)
+
+	go alarms.Raise(Alarm{Person: 1, Room: "Node_AA"})
+	done := make(chan struct{})
+	go func() {
+		for len(alarms.Open()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		alarms.Open()
+		alarms.Raised()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Alarm manager blocked while publishing an alarm")
+	}
+}
+
+func TestNotifierClose(t *testing.T) {
+	webhook := newWebhookServer(100)
+	defer webhook.Close()
+	tier2 := &testSink{notifications: make(chan Notification, 10)}
+	notifier := NewNotifier([]Sink{NewWebhookSink(webhook.URL, time.Second)}, []Sink{tier2}, 5, time.Hour, 100*time.Millisecond)
+	alarms := NewAlarmManager(nil, "", time.Minute, notifier)
+
+	_, _, err := alarms.Raise(Alarm{Person: 1, Room: "Node_AA", Severity: SeverityWarning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for requests := 0; requests == 0; {
+		time.Sleep(time.Millisecond)
+		webhook.mu.Lock()
+		requests = webhook.requests
+		webhook.mu.Unlock()
+	}
+
+	// Close cancels the retry waiting for an hour and the escalation
+	closed := make(chan struct{})
+	go func() {
+		notifier.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close waited for the backoff of the retry")
+	}
+	notifier.Close()
+	alarms.Raise(Alarm{Person: 2, Room: "Node_AA", Severity: SeverityWarning})
+	select {
+	case notification := <-tier2.notifications:
+		t.Errorf("Notification after closing: %+v", notification)
+	case <-time.After(200 * time.Millisecond):
+	}
+	webhook.mu.Lock()
+	defer webhook.mu.Unlock()
+	if webhook.requests != 1 {
+		t.Errorf("Requests = %d, want 1", webhook.requests)
+	}
+}
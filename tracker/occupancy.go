@@ -0,0 +1,186 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RoomOccupancy is the number of persons in a room, published on every change
+type RoomOccupancy struct {
+	Room  string `json:"room"`
+	Count int    `json:"count"`
+	// Capacity is the maximum number of persons allowed in the room, 0 when it's unlimited
+	Capacity  int    `json:"capacity"`
+	Persons   []int  `json:"persons"`
+	Timestamp string `json:"timestamp"`
+}
+
+// OverCapacity returns if there are more persons in the room than allowed
+func (r RoomOccupancy) OverCapacity() bool {
+	return r.Capacity > 0 && r.Count > r.Capacity
+}
+
+// occupancy keeps the persons in each room. A person enters a room when the tracker confirms the
+// location, and leaves it when the location changes or after not being detected during the timeout
+type occupancy struct {
+	timeout time.Duration
+	// capacities of the rooms, with the names in lower case because the configuration keys are
+	capacities map[string]int
+
+	mu       sync.Mutex
+	rooms    map[string]map[int]time.Time
+	location map[int]string
+}
+
+func newOccupancy(capacities map[string]int, timeout time.Duration) *occupancy {
+	o := &occupancy{
+		timeout:    timeout,
+		capacities: make(map[string]int),
+		rooms:      make(map[string]map[int]time.Time),
+		location:   make(map[int]string),
+	}
+	for room, capacity := range capacities {
+		o.capacities[strings.ToLower(room)] = capacity
+	}
+	return o
+}
+
+// enter marks the person as seen in the room at the time, leaving the previous room. It returns the
+// occupancy of the rooms that changed
+func (o *occupancy) enter(person int, room string, at time.Time) []RoomOccupancy {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	previous, ok := o.location[person]
+	if ok && previous == room {
+		o.rooms[room][person] = at
+		return nil
+	}
+
+	var changed []RoomOccupancy
+	if ok {
+		delete(o.rooms[previous], person)
+		changed = append(changed, o.snapshot(previous, at))
+	}
+	if o.rooms[room] == nil {
+		o.rooms[room] = make(map[int]time.Time)
+	}
+	o.rooms[room][person] = at
+	o.location[person] = room
+	return append(changed, o.snapshot(room, at))
+}
+
+// expire removes the persons that weren't seen during the timeout. It returns the occupancy of the
+// rooms that changed
+func (o *occupancy) expire(now time.Time) []RoomOccupancy {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var changed []RoomOccupancy
+	for room, persons := range o.rooms {
+		left := 0
+		for person, seen := range persons {
+			if now.Sub(seen) < o.timeout {
+				continue
+			}
+			log.Infof("[Occupancy] User %d left room %s, not detected since %s", person, room, seen.Format(time.RFC3339))
+			delete(persons, person)
+			delete(o.location, person)
+			left++
+		}
+		if left > 0 {
+			changed = append(changed, o.snapshot(room, now))
+		}
+	}
+	return changed
+}
+
+// room returns the current occupancy of a room
+func (o *occupancy) room(room string) RoomOccupancy {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.snapshot(room, time.Now())
+}
+
+func (o *occupancy) snapshot(room string, at time.Time) RoomOccupancy {
+	persons := make([]int, 0, len(o.rooms[room]))
+	for person := range o.rooms[room] {
+		persons = append(persons, person)
+	}
+	sort.Ints(persons)
+	return RoomOccupancy{
+		Room:      room,
+		Count:     len(persons),
+		Capacity:  o.capacities[strings.ToLower(room)],
+		Persons:   persons,
+		Timestamp: at.Format(time.RFC3339),
+	}
+}
+
+// Occupancy returns the number of persons currently in a room
+func (t *Tracker) Occupancy(room string) RoomOccupancy {
+	return t.occupancy.room(room)
+}
+
+// updateOccupancy publishes the occupancy of the rooms that changed and raises an alarm for the rooms
+// over their capacity
+func (t *Tracker) updateOccupancy(changed []RoomOccupancy) error {
+	var errs []string
+	for _, room := range changed {
+		log.Infof("[Occupancy] %d persons in room %s", room.Count, room.Room)
+		if room.OverCapacity() {
+			_, _, err := t.alarms.Raise(Alarm{
+				Kind:     AlarmCapacity,
+				Room:     room.Room,
+				Reason:   fmt.Sprintf("%d persons in the room, the capacity is %d", room.Count, room.Capacity),
+				Severity: SeverityWarning,
+				Features: map[string]float64{"occupants": float64(room.Count), "capacity": float64(room.Capacity)},
+			})
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if t.publisher == nil || t.config.OccupancyTopic == "" {
+			continue
+		}
+		byteData, err := json.Marshal(room)
+		if err != nil {
+			return err
+		}
+		err = t.publisher.Publish(fmt.Sprintf(t.config.OccupancyTopic, room.Room), byteData)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Error publishing occupancy of room %s: %v", room.Room, err.Error()))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// expireOccupants removes periodically the persons that left the rooms without being detected elsewhere
+func (t *Tracker) expireOccupants() {
+	interval := t.config.OccupancyTimeout / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case now := <-ticker.C:
+			err := t.updateOccupancy(t.occupancy.expire(now))
+			if err != nil {
+				log.Errorf("[Occupancy] %v", err.Error())
+			}
+		}
+	}
+}
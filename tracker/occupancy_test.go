@@ -0,0 +1,84 @@
+package tracker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOccupancyEnterAndExpire(t *testing.T) {
+	o := newOccupancy(map[string]int{"node_aa": 1}, time.Minute)
+	start := time.Now()
+
+	changed := o.enter(1, "Node_AA", start)
+	if len(changed) != 1 || changed[0].Count != 1 || changed[0].Capacity != 1 || changed[0].OverCapacity() {
+		t.Fatalf("Occupancy after entering = %+v, want 1 person of capacity 1", changed)
+	}
+	if changed := o.enter(1, "Node_AA", start.Add(30*time.Second)); changed != nil {
+		t.Errorf("Detection in the same room changed the occupancy: %+v", changed)
+	}
+	if changed := o.enter(2, "Node_AA", start); len(changed) != 1 || !changed[0].OverCapacity() {
+		t.Errorf("Occupancy with 2 persons = %+v, want over capacity", changed)
+	}
+
+	// Moving leaves the previous room
+	changed = o.enter(2, "Node_BB", start)
+	if len(changed) != 2 || changed[0].Room != "Node_AA" || changed[0].Count != 1 || changed[1].Room != "Node_BB" || changed[1].Count != 1 {
+		t.Errorf("Occupancy after moving = %+v, want 1 person in each room", changed)
+	}
+
+	// Person 2 wasn't seen since the start, person 1 was seen 30 seconds later
+	changed = o.expire(start.Add(time.Minute))
+	if len(changed) != 1 || changed[0].Room != "Node_BB" || changed[0].Count != 0 {
+		t.Errorf("Expired occupancy = %+v, want Node_BB empty", changed)
+	}
+	if room := o.room("Node_AA"); room.Count != 1 || len(room.Persons) != 1 || room.Persons[0] != 1 {
+		t.Errorf("Occupancy of Node_AA = %+v, want person 1", room)
+	}
+}
+
+func TestCapacityAlarm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := testConfig(t, dir)
+	config.PermissionsFile = ""
+	config.OccupancyTopic = "/Nodes/%v/Tracking/Occupancy"
+	config.Capacities = map[string]int{"Node_AA": 1}
+	publisher := &testPublisher{}
+	tracker, err := New(config, publisher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+
+	result, err := tracker.Process(Detection{Timestamp: "1", Person: 1, Room: "Node_AA"})
+	if err != nil || result.Alarm != nil || len(result.Occupancy) != 1 {
+		t.Fatalf("Result of the first person = %+v (error %v), want the occupancy without alarm", result, err)
+	}
+	if _, err := tracker.Process(Detection{Timestamp: "1", Person: 2, Room: "Node_AA"}); err != nil {
+		t.Fatal(err)
+	}
+	if occupancy := tracker.Occupancy("Node_AA"); occupancy.Count != 2 {
+		t.Errorf("Occupancy of Node_AA = %+v, want 2 persons", occupancy)
+	}
+
+	alarms := tracker.Alarms().Open()
+	if len(alarms) != 1 || alarms[0].Kind != AlarmCapacity || alarms[0].Room != "Node_AA" || alarms[0].Features["occupants"] != 2 {
+		t.Errorf("Open alarms = %+v, want a capacity alarm of Node_AA", alarms)
+	}
+	publisher.mu.Lock()
+	published := publisher.messages["/Nodes/Node_AA/Tracking/Occupancy"]
+	publisher.mu.Unlock()
+	if len(published) != 2 {
+		t.Fatalf("Published %d occupancy changes, want 2", len(published))
+	}
+	var last RoomOccupancy
+	if err := json.Unmarshal(published[1], &last); err != nil || last.Count != 2 || last.Capacity != 1 {
+		t.Errorf("Last occupancy published = %+v (error %v), want 2 persons of capacity 1", last, err)
+	}
+}
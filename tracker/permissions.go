@@ -0,0 +1,343 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mainprocess/files"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// AnyRoom matches every room in a permission rule
+const AnyRoom = "*"
+
+// permissionsReloadDelay is the time waited after the last file event before reloading the rules
+const permissionsReloadDelay = 500 * time.Millisecond
+
+type (
+	// PermissionRule allows or denies some persons and groups to be in some rooms. Empty fields
+	// don't restrict the rule, so a rule without weekdays applies every day
+	PermissionRule struct {
+		Deny    bool     `json:"deny" yaml:"deny"`
+		Persons []int    `json:"persons" yaml:"persons"`
+		Groups  []string `json:"groups" yaml:"groups"`
+		Rooms   []string `json:"rooms" yaml:"rooms"`
+		// Weekdays are the first three letters of the days, like "mon" or "sat"
+		Weekdays []string `json:"weekdays" yaml:"weekdays"`
+		// From and To are the time of the day as "15:04". If From is after To, the rule applies overnight
+		From string `json:"from" yaml:"from"`
+		To   string `json:"to" yaml:"to"`
+		// ValidFrom and ValidUntil are dates as "2006-01-02". ValidUntil is included
+		ValidFrom  string `json:"validfrom" yaml:"validfrom"`
+		ValidUntil string `json:"validuntil" yaml:"validuntil"`
+		// Escort allows the persons of an allow rule to escort unauthorized persons in its rooms
+		Escort bool `json:"escort" yaml:"escort"`
+	}
+
+	// PermissionRules is the content of a permissions file
+	PermissionRules struct {
+		// Groups maps each group name to its persons
+		Groups map[string][]int `json:"groups" yaml:"groups"`
+		Rules  []PermissionRule `json:"rules" yaml:"rules"`
+	}
+
+	// Decision is the result of checking the permission of a person to be in a room
+	Decision struct {
+		Allowed bool `json:"allowed"`
+		// Denied is true when a deny rule matched, instead of just missing an allow rule
+		Denied bool `json:"denied"`
+		// Escort is true when the person is allowed and can escort unauthorized persons in the room
+		Escort bool `json:"escort"`
+		// Escorted is true when the person isn't allowed, but is accompanied by an escort
+		Escorted bool   `json:"escorted"`
+		Reason   string `json:"reason"`
+	}
+
+	// PermissionStore keeps the rules loaded from a file and reloads them when the file changes
+	PermissionStore struct {
+		file string
+
+		mu    sync.RWMutex
+		rules PermissionRules
+
+		watcher *files.Watcher
+	}
+)
+
+// LoadPermissions creates a permission store with the rules of a YAML, JSON or CSV file
+func LoadPermissions(file string) (*PermissionStore, error) {
+	p := &PermissionStore{file: file}
+	err := p.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload reads again the rules from the file. If the file is invalid, the previous rules are kept
+func (p *PermissionStore) Reload() error {
+	rules, err := readPermissionRules(p.file)
+	if err != nil {
+		return fmt.Errorf("Can't load permissions from %s: %v", p.file, err.Error())
+	}
+	p.mu.Lock()
+	p.rules = rules
+	p.mu.Unlock()
+	log.Infof("[Tracker] Loaded %d permission rules and %d groups from %s", len(rules.Rules), len(rules.Groups), p.file)
+	return nil
+}
+
+// Check returns if the person is allowed to be in the room at the given time. Deny rules override
+// allow rules, and a person without any matching rule isn't allowed
+func (p *PermissionStore) Check(person int, room string, at time.Time) Decision {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	allowedBy := -1
+	escort := false
+	for i := range p.rules.Rules {
+		rule := &p.rules.Rules[i]
+		if !rule.matches(person, room, at, p.rules.Groups) {
+			continue
+		}
+		if rule.Deny {
+			return Decision{Allowed: false, Denied: true, Reason: fmt.Sprintf("denied by rule %d", i)}
+		}
+		if allowedBy == -1 {
+			allowedBy = i
+		}
+		escort = escort || rule.Escort
+	}
+	if allowedBy == -1 {
+		return Decision{Allowed: false, Reason: "no rule allows the person in the room"}
+	}
+	return Decision{Allowed: true, Escort: escort, Reason: fmt.Sprintf("allowed by rule %d", allowedBy)}
+}
+
+// Groups returns the groups of a person
+func (p *PermissionStore) Groups(person int) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var groups []string
+	for group, persons := range p.rules.Groups {
+		if containsInt(persons, person) {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// Watch starts reloading the rules in background when the file changes
+func (p *PermissionStore) Watch() error {
+	watcher, err := files.Watch("Tracker", []string{p.file}, permissionsReloadDelay, func([]string) {
+		err := p.Reload()
+		if err != nil {
+			log.Errorf("[Tracker] %v", err.Error())
+		}
+	})
+	if err != nil {
+		return err
+	}
+	p.watcher = watcher
+	return nil
+}
+
+// Close stops watching the file
+func (p *PermissionStore) Close() error {
+	if p.watcher == nil {
+		return nil
+	}
+	return p.watcher.Close()
+}
+
+func (r *PermissionRule) matches(person int, room string, at time.Time, groups map[string][]int) bool {
+	if !r.matchesPerson(person, groups) {
+		return false
+	}
+	if len(r.Rooms) > 0 && !containsString(r.Rooms, room) && !containsString(r.Rooms, AnyRoom) {
+		return false
+	}
+	if len(r.Weekdays) > 0 && !containsString(r.Weekdays, strings.ToLower(at.Weekday().String()[:3])) {
+		return false
+	}
+
+	date := at.Format("2006-01-02")
+	if r.ValidFrom != "" && date < r.ValidFrom {
+		return false
+	}
+	if r.ValidUntil != "" && date > r.ValidUntil {
+		return false
+	}
+
+	if r.From == "" && r.To == "" {
+		return true
+	}
+	clock := at.Format("15:04")
+	from, to := r.From, r.To
+	if from == "" {
+		from = "00:00"
+	}
+	if to == "" {
+		to = "24:00"
+	}
+	if from <= to {
+		return clock >= from && clock < to
+	}
+	return clock >= from || clock < to
+}
+
+func (r *PermissionRule) matchesPerson(person int, groups map[string][]int) bool {
+	if len(r.Persons) == 0 && len(r.Groups) == 0 {
+		return true
+	}
+	if containsInt(r.Persons, person) {
+		return true
+	}
+	for _, group := range r.Groups {
+		if containsInt(groups[group], person) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PermissionRule) validate() error {
+	for _, clock := range []string{r.From, r.To} {
+		if clock == "" || clock == "24:00" {
+			continue
+		}
+		if _, err := time.Parse("15:04", clock); err != nil {
+			return fmt.Errorf("invalid time %s", clock)
+		}
+	}
+	for _, date := range []string{r.ValidFrom, r.ValidUntil} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("invalid date %s", date)
+		}
+	}
+	for i, day := range r.Weekdays {
+		day = strings.ToLower(day)
+		if len(day) > 3 {
+			day = day[:3]
+		}
+		if !containsString([]string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}, day) {
+			return fmt.Errorf("invalid weekday %s", r.Weekdays[i])
+		}
+		r.Weekdays[i] = day
+	}
+	return nil
+}
+
+func readPermissionRules(file string) (PermissionRules, error) {
+	var rules PermissionRules
+	byteData, err := ioutil.ReadFile(file)
+	if err != nil {
+		return rules, err
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		err = json.Unmarshal(byteData, &rules)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(byteData, &rules)
+	case ".csv":
+		rules, err = parsePermissionsCSV(string(byteData))
+	default:
+		return rules, fmt.Errorf("unknown permissions file format %s", filepath.Ext(file))
+	}
+	if err != nil {
+		return rules, err
+	}
+
+	for i := range rules.Rules {
+		err = rules.Rules[i].validate()
+		if err != nil {
+			return rules, fmt.Errorf("rule %d: %v", i, err.Error())
+		}
+	}
+	return rules, nil
+}
+
+// parsePermissionsCSV reads rules from a CSV with the header
+// "type,name,persons,groups,rooms,weekdays,from,to,validfrom,validuntil,escort". The type is "allow",
+// "deny" or "group", and lists are separated by ";". Group rows only use the name and persons
+func parsePermissionsCSV(data string) (PermissionRules, error) {
+	rules := PermissionRules{Groups: make(map[string][]int)}
+	table, err := files.ParseCSV(data, "type")
+	if err != nil {
+		return rules, err
+	}
+	field, list := table.Field, table.List
+
+	for line, record := range table.Records {
+		var persons []int
+		for _, v := range list(record, "persons") {
+			person, err := strconv.Atoi(v)
+			if err != nil {
+				return rules, fmt.Errorf("line %d: invalid person %s", line+2, v)
+			}
+			persons = append(persons, person)
+		}
+
+		switch strings.ToLower(field(record, "type")) {
+		case "group":
+			name := field(record, "name")
+			rules.Groups[name] = append(rules.Groups[name], persons...)
+		case "allow", "deny":
+			rules.Rules = append(rules.Rules, PermissionRule{
+				Deny:       strings.ToLower(field(record, "type")) == "deny",
+				Persons:    persons,
+				Groups:     list(record, "groups"),
+				Rooms:      list(record, "rooms"),
+				Weekdays:   list(record, "weekdays"),
+				From:       field(record, "from"),
+				To:         field(record, "to"),
+				ValidFrom:  field(record, "validfrom"),
+				ValidUntil: field(record, "validuntil"),
+				Escort:     strings.ToLower(field(record, "escort")) == "true",
+			})
+		default:
+			return rules, fmt.Errorf("line %d: invalid type %s", line+2, field(record, "type"))
+		}
+	}
+	return rules, nil
+}
+
+// detectionTime parses the timestamp of a detection. Timestamps that aren't RFC3339 dates are
+// sensor counters, so the current time is used instead
+func detectionTime(timestamp string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return time.Now()
+	}
+	return t.Local()
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
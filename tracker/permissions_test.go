@@ -0,0 +1,152 @@
+package tracker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testPermissionsYAML = `
+groups:
+  staff: [1, 2]
+rules:
+  - groups: [staff]
+    rooms: ["*"]
+  - persons: [2]
+    rooms: [Node_BB]
+    deny: true
+  - persons: [3]
+    rooms: [Node_AA]
+    weekdays: [mon, tue, wed, thu, fri]
+    from: "08:00"
+    to: "18:00"
+  - persons: [4]
+    rooms: [Node_AA]
+    from: "22:00"
+    to: "06:00"
+    validfrom: "2020-01-01"
+    validuntil: "2020-12-31"
+`
+
+const testPermissionsCSV = `type,name,persons,groups,rooms,weekdays,from,to,validfrom,validuntil
+group,staff,1;2,,,,,,,
+allow,,,staff,*,,,,,
+deny,,2,,Node_BB,,,,,
+allow,,3,,Node_AA,mon;tue;wed;thu;fri,08:00,18:00,,
+allow,,4,,Node_AA,,22:00,06:00,2020-01-01,2020-12-31
+`
+
+func writeFile(t *testing.T, dir, name, data string) string {
+	file := filepath.Join(dir, name)
+	err := ioutil.WriteFile(file, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestPermissionRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "permissions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	monday := time.Date(2020, 6, 1, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		person  int
+		room    string
+		at      time.Time
+		allowed bool
+	}{
+		{"group in any room", 1, "Node_CC", monday, true},
+		{"deny overrides the group", 2, "Node_BB", monday, false},
+		{"group in other room", 2, "Node_AA", monday, true},
+		{"weekday in hours", 3, "Node_AA", monday, true},
+		{"weekday out of hours", 3, "Node_AA", monday.Add(9 * time.Hour), false},
+		{"weekend", 3, "Node_AA", monday.AddDate(0, 0, 5), false},
+		{"other room", 3, "Node_BB", monday, false},
+		{"overnight before midnight", 4, "Node_AA", monday.Add(13 * time.Hour), true},
+		{"overnight after midnight", 4, "Node_AA", monday.Add(-5 * time.Hour), true},
+		{"overnight during the day", 4, "Node_AA", monday, false},
+		{"overnight after the validity", 4, "Node_AA", monday.AddDate(1, 0, 0).Add(13 * time.Hour), false},
+		{"person without rules", 5, "Node_AA", monday, false},
+	}
+
+	for _, file := range []string{
+		writeFile(t, dir, "permissions.yaml", testPermissionsYAML),
+		writeFile(t, dir, "permissions.csv", testPermissionsCSV),
+	} {
+		permissions, err := LoadPermissions(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, test := range tests {
+			t.Run(filepath.Ext(file)+" "+test.name, func(t *testing.T) {
+				decision := permissions.Check(test.person, test.room, test.at)
+				if decision.Allowed != test.allowed {
+					t.Errorf("Check(%d, %s, %v) = %+v, want allowed %v", test.person, test.room, test.at, decision, test.allowed)
+				}
+			})
+		}
+		if groups := permissions.Groups(2); len(groups) != 1 || groups[0] != "staff" {
+			t.Errorf("Groups of person 2 = %v, want [staff]", groups)
+		}
+	}
+}
+
+func TestInvalidPermissions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "permissions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, data := range map[string]string{
+		"time.yaml":    "rules:\n  - persons: [1]\n    from: \"25:00\"\n",
+		"weekday.yaml": "rules:\n  - persons: [1]\n    weekdays: [someday]\n",
+		"type.csv":     "type,persons\nmaybe,1\n",
+		"rules.txt":    "allow everyone",
+	} {
+		_, err := LoadPermissions(writeFile(t, dir, name, data))
+		if err == nil {
+			t.Errorf("Loaded invalid permissions %s", name)
+		}
+	}
+
+	// An invalid file keeps the rules loaded before
+	file := writeFile(t, dir, "permissions.yaml", testPermissionsYAML)
+	permissions, err := LoadPermissions(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "permissions.yaml", "rules: [")
+	if permissions.Reload() == nil {
+		t.Error("Reloaded invalid permissions")
+	}
+	if !permissions.Check(1, "Node_AA", time.Now()).Allowed {
+		t.Error("Rules lost after reloading an invalid file")
+	}
+}
+
+func TestDenyRuleDecision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "permissions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	permissions, err := LoadPermissions(writeFile(t, dir, "permissions.yaml", testPermissionsYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decision := permissions.Check(2, "Node_BB", time.Now()); decision.Allowed || !decision.Denied {
+		t.Errorf("Decision of a deny rule = %+v, want denied", decision)
+	}
+	if decision := permissions.Check(5, "Node_BB", time.Now()); decision.Allowed || decision.Denied {
+		t.Errorf("Decision without rules = %+v, want not allowed and not denied", decision)
+	}
+}
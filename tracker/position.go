@@ -0,0 +1,152 @@
+package tracker
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// noSignal is the value of the RFID power and WiFi RSSI when the person wasn't detected by that sensor
+const noSignal = -100
+
+// positionTracker keeps the last confirmed location of each person and the detections in other
+// rooms, so that a location change is only committed after several consecutive detections
+type positionTracker struct {
+	// store has the last location of the persons that weren't detected since the process started
+	store LocationStore
+
+	mu      sync.Mutex
+	last    map[int]LocationStruct
+	pending map[int]LocationStruct
+	// signals has the signal of each person in each room where it was detected in its last window
+	signals map[int]windowSignals
+}
+
+// windowSignals is the signal of a person in the rooms where it was detected during a window
+type windowSignals struct {
+	window string
+	rooms  map[string]LocationStruct
+}
+
+func newPositionTracker(store LocationStore) *positionTracker {
+	return &positionTracker{
+		store:   store,
+		last:    make(map[int]LocationStruct),
+		pending: make(map[int]LocationStruct),
+		signals: make(map[int]windowSignals),
+	}
+}
+
+// observe keeps the signal of a detection in its window, so that the detections in another room of
+// the same window can be compared with it. It must be called with every detection of a window before
+// updating any of them
+func (p *positionTracker) observe(detection LocationStruct, window string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	signals, ok := p.signals[detection.Person]
+	if !ok || signals.window != window {
+		signals = windowSignals{window: window, rooms: make(map[string]LocationStruct)}
+		p.signals[detection.Person] = signals
+	}
+	signals.rooms[detection.Location] = detection
+}
+
+// update adds a new detection of a person. It returns the location to store when the detection
+// is the first one of the person or a confirmed location change, and false otherwise. The change is
+// confirmed when the person is detected changeCounter consecutive times in the new room, and the RFID
+// power or the WiFi RSSI are at least changeCounterRfid or changeCounterWifi stronger than in the last
+// room during the same window
+func (p *positionTracker) update(detection LocationStruct, window string, changeCounter int, changeCounterRfid, changeCounterWifi float64) (LocationStruct, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	last, ok := p.last[detection.Person]
+	if !ok && p.store != nil {
+		var err error
+		last, ok, err = p.store.LastForPerson(detection.Person)
+		if err != nil {
+			return LocationStruct{}, false, fmt.Errorf("Unable to get last location of user %d: %v", detection.Person, err.Error())
+		}
+	}
+	if !ok {
+		detection.Counter = 1
+		p.last[detection.Person] = detection
+		return detection, true, nil
+	}
+
+	if last.Location == detection.Location {
+		if pending, ok := p.pending[detection.Person]; ok {
+			log.Debugf("[Tracker] User %d back in room %s, discarding %d detections in room %s", detection.Person, last.Location, pending.Counter, pending.Location)
+			delete(p.pending, detection.Person)
+		}
+		p.last[detection.Person] = last
+		return LocationStruct{}, false, nil
+	}
+
+	pending, ok := p.pending[detection.Person]
+	if ok && pending.Location == detection.Location {
+		// The counter stops at changeCounter while the signal isn't stronger than in the last room
+		detection.Counter = pending.Counter + 1
+		if detection.Counter > changeCounter {
+			detection.Counter = changeCounter
+		}
+	} else {
+		detection.Counter = 1
+	}
+	p.pending[detection.Person] = detection
+
+	if detection.Counter < changeCounter {
+		log.Debugf("[Tracker] User %d detected in room %s %d/%d times, last location %s", detection.Person, detection.Location, detection.Counter, changeCounter, last.Location)
+		return LocationStruct{}, false, nil
+	}
+	previous, detected := p.signalIn(detection.Person, last.Location, window)
+	if detected && !strongerSignal(detection, previous, changeCounterRfid, changeCounterWifi) {
+		log.Debugf("[Tracker] User %d detected in room %s %d times, but the signal isn't stronger than in %s", detection.Person, detection.Location, detection.Counter, last.Location)
+		return LocationStruct{}, false, nil
+	}
+
+	log.Infof("[Tracker] User %d moved from room %s to %s after %d detections", detection.Person, last.Location, detection.Location, detection.Counter)
+	delete(p.pending, detection.Person)
+	p.last[detection.Person] = detection
+	return detection, true, nil
+}
+
+// location returns the confirmed location of a person
+func (p *positionTracker) location(person int) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	last, ok := p.last[person]
+	return last.Location, ok
+}
+
+// signalIn returns the signal of a person in a room during a window, and false if the person wasn't
+// detected there in that window
+func (p *positionTracker) signalIn(person int, room, window string) (LocationStruct, bool) {
+	signals, ok := p.signals[person]
+	if !ok || signals.window != window {
+		return LocationStruct{}, false
+	}
+	signal, ok := signals.rooms[room]
+	return signal, ok
+}
+
+// strongerSignal checks if the RFID power or the WiFi RSSI of the detection are at least the threshold
+// stronger than in the last location during the same window. Signals that weren't measured in both
+// locations aren't compared, and if none can be compared the check passes
+func strongerSignal(detection, last LocationStruct, thresholdRfid, thresholdWifi float64) bool {
+	compared := false
+	if detection.Rfid > noSignal && last.Rfid > noSignal {
+		compared = true
+		if detection.Rfid-last.Rfid >= thresholdRfid {
+			return true
+		}
+	}
+	if detection.Wifi > noSignal && last.Wifi > noSignal {
+		compared = true
+		if detection.Wifi-last.Wifi >= thresholdWifi {
+			return true
+		}
+	}
+	return !compared
+}
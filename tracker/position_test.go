@@ -0,0 +1,78 @@
+package tracker
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPositionWeakerReaderInNewRoom(t *testing.T) {
+	positions := newPositionTracker(nil)
+	// update processes the detections of a window, after observing all of them
+	update := func(window int, changeCounter int, detections ...LocationStruct) (LocationStruct, bool) {
+		var moved LocationStruct
+		changed := false
+		for _, detection := range detections {
+			positions.observe(detection, fmt.Sprint(window))
+		}
+		for _, detection := range detections {
+			location, ok, err := positions.update(detection, fmt.Sprint(window), changeCounter, 5, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				moved, changed = location, true
+			}
+		}
+		return moved, changed
+	}
+	in := func(room string, rfid float64) LocationStruct {
+		return LocationStruct{Person: 1, Location: room, Rfid: rfid, Wifi: noSignal}
+	}
+
+	// The signal of the first location is weaker than the reader of the new room, but the person is
+	// closer to the reader of the old room in the window where both detect it
+	if _, ok := update(1, 1, in("Node_AA", -80)); !ok {
+		t.Fatal("First location not stored")
+	}
+	for window := 2; window <= 3; window++ {
+		if location, ok := update(window, 1, in("Node_BB", -70), in("Node_AA", -50)); ok {
+			t.Fatalf("Window %d moved to %+v with a weaker signal than in the last room", window, location)
+		}
+	}
+	if room, _ := positions.location(1); room != "Node_AA" {
+		t.Errorf("Location = %s, want Node_AA", room)
+	}
+
+	// Once the person is only detected in the new room, the change is confirmed after changeCounter windows
+	if _, ok := update(4, 2, in("Node_BB", -70)); ok {
+		t.Error("Location changed after a single detection")
+	}
+	location, ok := update(5, 2, in("Node_BB", -70))
+	if !ok || location.Location != "Node_BB" || location.Counter != 2 {
+		t.Errorf("Location after two detections = %+v (changed %v), want Node_BB after 2 detections", location, ok)
+	}
+}
+
+func TestPositionStrongerSignalInSameWindow(t *testing.T) {
+	positions := newPositionTracker(nil)
+	first := LocationStruct{Person: 1, Location: "Node_AA", Rfid: -50, Wifi: noSignal}
+	positions.observe(first, "1")
+	if _, ok, _ := positions.update(first, "1", 1, 5, 5); !ok {
+		t.Fatal("First location not stored")
+	}
+
+	old := LocationStruct{Person: 1, Location: "Node_AA", Rfid: -60, Wifi: noSignal}
+	weaker := LocationStruct{Person: 1, Location: "Node_BB", Rfid: -62, Wifi: noSignal}
+	positions.observe(old, "2")
+	positions.observe(weaker, "2")
+	if _, ok, _ := positions.update(weaker, "2", 1, 5, 5); ok {
+		t.Error("Location changed with a signal 2 dB weaker than in the last room")
+	}
+
+	stronger := LocationStruct{Person: 1, Location: "Node_BB", Rfid: -54, Wifi: noSignal}
+	positions.observe(old, "3")
+	positions.observe(stronger, "3")
+	if location, ok, _ := positions.update(stronger, "3", 1, 5, 5); !ok || location.Location != "Node_BB" {
+		t.Errorf("Location with a signal 6 dB stronger = %+v (changed %v), want Node_BB", location, ok)
+	}
+}
@@ -0,0 +1,138 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Retention policies of the old location logs
+const (
+	// RetentionDelete removes the old locations
+	RetentionDelete = "delete"
+	// RetentionAggregate replaces the old locations by the number of locations and persons of each
+	// room and day, without the person IDs
+	RetentionAggregate = "aggregate"
+)
+
+// retentionInterval is the time between two runs of the retention policy in the tracker
+const retentionInterval = time.Hour
+
+// RoomDay is the aggregate of the locations of a room during a day
+type RoomDay struct {
+	Day       string `json:"day"`
+	Room      string `json:"room"`
+	Locations int    `json:"locations"`
+	Persons   int    `json:"persons"`
+	Alarms    int    `json:"alarms"`
+}
+
+// RetentionCutoff returns the start of the day before which the locations are older than the days.
+// Whole days are used, so each day is only aggregated once
+func RetentionCutoff(now time.Time, days int) time.Time {
+	day := now.AddDate(0, 0, -days)
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+}
+
+// ApplyRetention removes the locations recorded before the cutoff. With the aggregate policy, the
+// aggregates of each room and day are appended to the aggregate file first. Returns the number of
+// locations removed
+func ApplyRetention(store LocationStore, policy string, aggregateFile string, cutoff time.Time) (int, error) {
+	query := LocationQuery{To: cutoff}
+	switch policy {
+	case RetentionDelete:
+	case RetentionAggregate:
+		records, err := store.Query(query)
+		if err != nil {
+			return 0, err
+		}
+		if len(records) == 0 {
+			return 0, nil
+		}
+		err = appendAggregates(aggregateFile, aggregateRoomDays(records))
+		if err != nil {
+			return 0, fmt.Errorf("Can't write aggregates to %s: %v", aggregateFile, err.Error())
+		}
+	default:
+		return 0, fmt.Errorf("Unknown retention policy %s", policy)
+	}
+	return store.Delete(query)
+}
+
+// aggregateRoomDays counts the locations, distinct persons and alarms of each room and day
+func aggregateRoomDays(records []LocationStruct) []RoomDay {
+	type dayKey struct{ day, room string }
+	aggregates := make(map[dayKey]*RoomDay)
+	persons := make(map[dayKey]map[int]bool)
+	for _, record := range records {
+		key := dayKey{record.Recorded.Format("2006-01-02"), record.Location}
+		aggregate, ok := aggregates[key]
+		if !ok {
+			aggregate = &RoomDay{Day: key.day, Room: key.room}
+			aggregates[key] = aggregate
+			persons[key] = make(map[int]bool)
+		}
+		aggregate.Locations++
+		if record.Alarm {
+			aggregate.Alarms++
+		}
+		persons[key][record.Person] = true
+	}
+
+	result := make([]RoomDay, 0, len(aggregates))
+	for key, aggregate := range aggregates {
+		aggregate.Persons = len(persons[key])
+		result = append(result, *aggregate)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Day != result[j].Day {
+			return result[i].Day < result[j].Day
+		}
+		return result[i].Room < result[j].Room
+	})
+	return result
+}
+
+func appendAggregates(file string, aggregates []RoomDay) error {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	for _, aggregate := range aggregates {
+		byteData, err := json.Marshal(aggregate)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		_, err = f.Write(append(byteData, '\n'))
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// applyRetention runs the retention policy of the configuration periodically
+func (t *Tracker) applyRetention() {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		removed, err := ApplyRetention(t.store, t.config.RetentionPolicy, t.config.AggregateFile, RetentionCutoff(time.Now(), t.config.RetentionDays))
+		if err != nil {
+			log.Errorf("[Retention] %v", err.Error())
+		} else if removed > 0 {
+			log.Infof("[Retention] Applied %s policy to %d locations older than %d days", t.config.RetentionPolicy, removed, t.config.RetentionDays)
+		}
+
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
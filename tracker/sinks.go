@@ -0,0 +1,157 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// WebhookSink posts the notifications as JSON to an URL
+	WebhookSink struct {
+		URL    string
+		Client *http.Client
+	}
+
+	// MailSink sends the notifications by mail through a SMTP server without authentication, like
+	// a local relay
+	MailSink struct {
+		Server string
+		From   string
+		To     []string
+	}
+
+	// MQTTSink publishes the notifications in a topic
+	MQTTSink struct {
+		Publisher Publisher
+		Topic     string
+	}
+
+	// FileSink appends the notifications to a JSON lines file. When the file reaches MaxSize bytes
+	// it's rotated to file.1, file.2..., keeping MaxFiles old files
+	FileSink struct {
+		Path     string
+		MaxSize  int64
+		MaxFiles int
+
+		mu sync.Mutex
+	}
+)
+
+// NewWebhookSink creates a webhook sink with a timeout for each request
+func NewWebhookSink(url string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{URL: url, Client: &http.Client{Timeout: timeout}}
+}
+
+// Name returns the URL of the webhook
+func (w *WebhookSink) Name() string {
+	return "webhook " + w.URL
+}
+
+// Notify posts the notification and fails if the response isn't 2xx
+func (w *WebhookSink) Notify(notification Notification) error {
+	byteData, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	resp, err := w.Client.Post(w.URL, "application/json", bytes.NewReader(byteData))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Name returns the recipients of the mails
+func (m *MailSink) Name() string {
+	return "mail " + strings.Join(m.To, ",")
+}
+
+// Notify sends a mail with a summary of the alarm and the whole notification as JSON
+func (m *MailSink) Notify(notification Notification) error {
+	byteData, err := json.MarshalIndent(notification, "", "  ")
+	if err != nil {
+		return err
+	}
+	alarm := notification.Alarm
+	subject := fmt.Sprintf("[Tracker] %s %s alarm %s in room %s", alarm.Severity, alarm.Kind, notification.Event, alarm.Room)
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", m.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&body, "%s\r\n\r\n%s\r\n", alarm.Reason, strings.ReplaceAll(string(byteData), "\n", "\r\n"))
+	return smtp.SendMail(m.Server, nil, m.From, m.To, body.Bytes())
+}
+
+// Name returns the topic of the sink
+func (m *MQTTSink) Name() string {
+	return "mqtt " + m.Topic
+}
+
+// Notify publishes the notification as JSON
+func (m *MQTTSink) Notify(notification Notification) error {
+	byteData, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	return m.Publisher.Publish(m.Topic, byteData)
+}
+
+// Name returns the path of the file
+func (f *FileSink) Name() string {
+	return "file " + f.Path
+}
+
+// Notify appends the notification to the file, rotating it first if it's full
+func (f *FileSink) Notify(notification Notification) error {
+	byteData, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	byteData = append(byteData, '\n')
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if info, err := os.Stat(f.Path); err == nil && f.MaxSize > 0 && info.Size()+int64(len(byteData)) > f.MaxSize {
+		err = f.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(byteData)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// rotate moves file.N-1 to file.N, ..., and the file to file.1, removing the oldest one
+func (f *FileSink) rotate() error {
+	if f.MaxFiles <= 0 {
+		return os.Remove(f.Path)
+	}
+	os.Remove(fmt.Sprintf("%s.%d", f.Path, f.MaxFiles))
+	for i := f.MaxFiles - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", f.Path, i), fmt.Sprintf("%s.%d", f.Path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(f.Path, f.Path+".1")
+}
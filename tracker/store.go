@@ -0,0 +1,81 @@
+package tracker
+
+import (
+	"fmt"
+	"time"
+)
+
+// Storage backends available for the location logs
+const (
+	StorageBolt  = "bolt"
+	StorageJSONL = "jsonl"
+)
+
+type (
+	// LocationQuery filters the stored locations. Zero values don't filter
+	LocationQuery struct {
+		Person *int
+		Room   string
+		// From is included and To is excluded
+		From time.Time
+		To   time.Time
+	}
+
+	// LocationStore stores the location logs of the tracker
+	LocationStore interface {
+		// Save stores a new location log
+		Save(record LocationStruct) error
+		// LastForPerson returns the last location stored for a person, and false if there is none
+		LastForPerson(person int) (LocationStruct, bool, error)
+		// Latest returns the last location stored for each person, sorted by person
+		Latest() ([]LocationStruct, error)
+		// Query returns the stored locations matching the query, sorted by the time they were recorded
+		Query(query LocationQuery) ([]LocationStruct, error)
+		// Delete removes the stored locations matching the query and returns how many were removed
+		Delete(query LocationQuery) (int, error)
+		// Rewrite replaces the stored locations matching the query with the result of fn, which must
+		// keep the recorded time, and returns how many were replaced
+		Rewrite(query LocationQuery, fn func(LocationStruct) LocationStruct) (int, error)
+		Close() error
+	}
+)
+
+// OpenLocationStore opens a location store of the given kind in the path
+func OpenLocationStore(kind, path string) (LocationStore, error) {
+	switch kind {
+	case StorageBolt:
+		return OpenBoltStore(path)
+	case StorageJSONL:
+		return OpenJSONLStore(path)
+	}
+	return nil, fmt.Errorf("Unknown storage backend %s", kind)
+}
+
+// OpenLocationStoreReadOnly opens an existing location store of the given kind in the path only to
+// read it. Several readers can open it at the same time, but not while it's open to write
+func OpenLocationStoreReadOnly(kind, path string) (LocationStore, error) {
+	switch kind {
+	case StorageBolt:
+		return OpenBoltStoreReadOnly(path)
+	case StorageJSONL:
+		return OpenJSONLStoreReadOnly(path)
+	}
+	return nil, fmt.Errorf("Unknown storage backend %s", kind)
+}
+
+// Matches returns if the record passes the filters of the query
+func (q LocationQuery) Matches(record LocationStruct) bool {
+	if q.Person != nil && record.Person != *q.Person {
+		return false
+	}
+	if q.Room != "" && record.Location != q.Room {
+		return false
+	}
+	if !q.From.IsZero() && record.Recorded.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !record.Recorded.Before(q.To) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,265 @@
+package tracker
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// Every location, with the recorded time and a sequence as key
+	locationsBucket = []byte("locations")
+	// One bucket for each person, with the same keys as the locations bucket
+	personsBucket = []byte("persons")
+)
+
+// BoltStore stores the location logs in an embedded bbolt database
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStoreReadOnly opens an existing bbolt database in the path only to read it
+func OpenBoltStoreReadOnly(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// OpenBoltStore opens or creates a bbolt database in the path
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{locationsBucket, personsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Save stores a new location log
+func (b *BoltStore) Save(record LocationStruct) error {
+	if record.Recorded.IsZero() {
+		record.Recorded = time.Now()
+	}
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		locations := tx.Bucket(locationsBucket)
+		seq, err := locations.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := boltKey(record.Recorded, seq)
+		err = locations.Put(key, value)
+		if err != nil {
+			return err
+		}
+		person, err := tx.Bucket(personsBucket).CreateBucketIfNotExists([]byte(strconv.Itoa(record.Person)))
+		if err != nil {
+			return err
+		}
+		return person.Put(key, value)
+	})
+}
+
+// LastForPerson returns the last location stored for a person
+func (b *BoltStore) LastForPerson(person int) (LocationStruct, bool, error) {
+	var record LocationStruct
+	found := false
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(personsBucket).Bucket([]byte(strconv.Itoa(person)))
+		if bucket == nil {
+			return nil
+		}
+		_, value := bucket.Cursor().Last()
+		if value == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(value, &record)
+	})
+	return record, found, err
+}
+
+// Latest returns the last location stored for each person
+func (b *BoltStore) Latest() ([]LocationStruct, error) {
+	var records []LocationStruct
+	err := b.db.View(func(tx *bolt.Tx) error {
+		persons := tx.Bucket(personsBucket)
+		return persons.ForEach(func(name, _ []byte) error {
+			bucket := persons.Bucket(name)
+			if bucket == nil {
+				return nil
+			}
+			_, value := bucket.Cursor().Last()
+			if value == nil {
+				return nil
+			}
+			var record LocationStruct
+			err := json.Unmarshal(value, &record)
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Person < records[j].Person
+	})
+	return records, err
+}
+
+// Query returns the stored locations matching the query. Queries of a single person only read
+// the bucket of that person
+func (b *BoltStore) Query(query LocationQuery) ([]LocationStruct, error) {
+	var records []LocationStruct
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return scanBolt(tx, query, func(_ []byte, record LocationStruct) {
+			records = append(records, record)
+		})
+	})
+	return records, err
+}
+
+// Delete removes the stored locations matching the query from the locations and persons buckets
+func (b *BoltStore) Delete(query LocationQuery) (int, error) {
+	deleted := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		// The keys are collected first, because deleting moves the cursor
+		var keys [][]byte
+		var persons []int
+		err := scanBolt(tx, query, func(key []byte, record LocationStruct) {
+			keys = append(keys, append([]byte(nil), key...))
+			persons = append(persons, record.Person)
+		})
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			err = tx.Bucket(locationsBucket).Delete(key)
+			if err != nil {
+				return err
+			}
+			if person := tx.Bucket(personsBucket).Bucket([]byte(strconv.Itoa(persons[i]))); person != nil {
+				err = person.Delete(key)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		deleted = len(keys)
+		return nil
+	})
+	return deleted, err
+}
+
+// Rewrite replaces the stored locations matching the query, moving them to the bucket of the new person
+func (b *BoltStore) Rewrite(query LocationQuery, fn func(LocationStruct) LocationStruct) (int, error) {
+	rewritten := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var keys [][]byte
+		var records []LocationStruct
+		err := scanBolt(tx, query, func(key []byte, record LocationStruct) {
+			keys = append(keys, append([]byte(nil), key...))
+			records = append(records, record)
+		})
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			record := fn(records[i])
+			value, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			err = tx.Bucket(locationsBucket).Put(key, value)
+			if err != nil {
+				return err
+			}
+			if old := tx.Bucket(personsBucket).Bucket([]byte(strconv.Itoa(records[i].Person))); old != nil {
+				err = old.Delete(key)
+				if err != nil {
+					return err
+				}
+			}
+			person, err := tx.Bucket(personsBucket).CreateBucketIfNotExists([]byte(strconv.Itoa(record.Person)))
+			if err != nil {
+				return err
+			}
+			err = person.Put(key, value)
+			if err != nil {
+				return err
+			}
+		}
+		rewritten = len(keys)
+		return nil
+	})
+	return rewritten, err
+}
+
+// Close closes the database
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
+
+// scanBolt calls fn with the key of each location matching the query. Queries of a single person only
+// read the bucket of that person
+func scanBolt(tx *bolt.Tx, query LocationQuery, fn func(key []byte, record LocationStruct)) error {
+	bucket := tx.Bucket(locationsBucket)
+	if query.Person != nil {
+		bucket = tx.Bucket(personsBucket).Bucket([]byte(strconv.Itoa(*query.Person)))
+		if bucket == nil {
+			return nil
+		}
+	}
+
+	cursor := bucket.Cursor()
+	var key, value []byte
+	if query.From.IsZero() {
+		key, value = cursor.First()
+	} else {
+		key, value = cursor.Seek(boltKey(query.From, 0))
+	}
+	for ; key != nil; key, value = cursor.Next() {
+		var record LocationStruct
+		err := json.Unmarshal(value, &record)
+		if err != nil {
+			return err
+		}
+		if !query.To.IsZero() && !record.Recorded.Before(query.To) {
+			break
+		}
+		if query.Matches(record) {
+			fn(key, record)
+		}
+	}
+	return nil
+}
+
+// boltKey sorts the locations by the time they were recorded
+func boltKey(recorded time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[:8], uint64(recorded.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
@@ -0,0 +1,254 @@
+package tracker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JSONLStore stores the location logs in an append-only file with one JSON record per line. The
+// store is locked while it's open, since the file is replaced when records are deleted or rewritten
+type JSONLStore struct {
+	path string
+	lock *os.File
+	// readOnly stores only take a shared lock and have no file to append to
+	readOnly bool
+
+	mu   sync.Mutex
+	file *os.File
+	last map[int]LocationStruct
+}
+
+// OpenJSONLStore opens or creates a JSON lines file in the path
+func OpenJSONLStore(path string) (*JSONLStore, error) {
+	return openJSONLStore(path, false)
+}
+
+// OpenJSONLStoreReadOnly opens an existing JSON lines file in the path only to read it
+func OpenJSONLStoreReadOnly(path string) (*JSONLStore, error) {
+	return openJSONLStore(path, true)
+}
+
+func openJSONLStore(path string, readOnly bool) (*JSONLStore, error) {
+	lock, err := lockStore(path, !readOnly)
+	if err != nil {
+		return nil, err
+	}
+	var file *os.File
+	if readOnly {
+		_, err = os.Stat(path)
+	} else {
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	s := &JSONLStore{path: path, lock: lock, readOnly: readOnly, file: file, last: make(map[int]LocationStruct)}
+
+	// The last location of each person is kept in memory, so it isn't read again for each detection
+	err = s.scan(func(record LocationStruct) {
+		if last, ok := s.last[record.Person]; !ok || !record.Recorded.Before(last.Recorded) {
+			s.last[record.Person] = record
+		}
+	})
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save appends a new location log to the file
+func (s *JSONLStore) Save(record LocationStruct) error {
+	if record.Recorded.IsZero() {
+		record.Recorded = time.Now()
+	}
+	if s.readOnly {
+		return fmt.Errorf("Location store %s is open read-only", s.path)
+	}
+	byteData, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(byteData, '\n'))
+	if err != nil {
+		return err
+	}
+	s.last[record.Person] = record
+	return nil
+}
+
+// LastForPerson returns the last location stored for a person
+func (s *JSONLStore) LastForPerson(person int) (LocationStruct, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.last[person]
+	return record, ok, nil
+}
+
+// Latest returns the last location stored for each person
+func (s *JSONLStore) Latest() ([]LocationStruct, error) {
+	s.mu.Lock()
+	records := make([]LocationStruct, 0, len(s.last))
+	for _, record := range s.last {
+		records = append(records, record)
+	}
+	s.mu.Unlock()
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Person < records[j].Person
+	})
+	return records, nil
+}
+
+// Query reads the whole file and returns the locations matching the query
+func (s *JSONLStore) Query(query LocationQuery) ([]LocationStruct, error) {
+	var records []LocationStruct
+	s.mu.Lock()
+	err := s.scan(func(record LocationStruct) {
+		if query.Matches(record) {
+			records = append(records, record)
+		}
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Recorded.Before(records[j].Recorded)
+	})
+	return records, nil
+}
+
+// Delete rewrites the file without the locations matching the query
+func (s *JSONLStore) Delete(query LocationQuery) (int, error) {
+	return s.rewrite(func(record LocationStruct) (LocationStruct, bool, bool) {
+		if query.Matches(record) {
+			return record, false, true
+		}
+		return record, true, false
+	})
+}
+
+// Rewrite rewrites the file replacing the locations matching the query
+func (s *JSONLStore) Rewrite(query LocationQuery, fn func(LocationStruct) LocationStruct) (int, error) {
+	return s.rewrite(func(record LocationStruct) (LocationStruct, bool, bool) {
+		if query.Matches(record) {
+			return fn(record), true, true
+		}
+		return record, true, false
+	})
+}
+
+// Close closes the file and releases the lock
+func (s *JSONLStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if s.file != nil {
+		err = s.file.Close()
+	}
+	s.lock.Close()
+	return err
+}
+
+func (s *JSONLStore) scan(fn func(record LocationStruct)) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record LocationStruct
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return fmt.Errorf("Invalid record in %s line %d: %v", s.path, line, err.Error())
+		}
+		fn(record)
+	}
+	return scanner.Err()
+}
+
+// rewrite writes a new file with the records returned by fn, which also returns if the record is kept
+// and if it changed, and replaces the current file with it. Returns the number of changed records. If
+// a record can't be written, the current file is kept
+func (s *JSONLStore) rewrite(fn func(record LocationStruct) (LocationStruct, bool, bool)) (int, error) {
+	if s.readOnly {
+		return 0, fmt.Errorf("Location store %s is open read-only", s.path)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.OpenFile(s.path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	writer := bufio.NewWriter(tmp)
+	changed := 0
+	last := make(map[int]LocationStruct)
+	var marshalErr error
+	err = s.scan(func(record LocationStruct) {
+		if marshalErr != nil {
+			return
+		}
+		record, keep, ok := fn(record)
+		if ok {
+			changed++
+		}
+		if !keep {
+			return
+		}
+		byteData, err := json.Marshal(record)
+		if err != nil {
+			marshalErr = fmt.Errorf("Unable to write location of user %d recorded at %v: %v", record.Person, record.Recorded, err.Error())
+			return
+		}
+		writer.Write(append(byteData, '\n'))
+		if previous, ok := last[record.Person]; !ok || !record.Recorded.Before(previous.Recorded) {
+			last[record.Person] = record
+		}
+	})
+	if err == nil {
+		err = marshalErr
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+
+	s.file.Close()
+	renameErr := os.Rename(tmp.Name(), s.path)
+	// The file is opened again even if the rename failed, so the store keeps working with the old records
+	s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if renameErr != nil {
+		os.Remove(tmp.Name())
+		return 0, renameErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.last = last
+	return changed, nil
+}
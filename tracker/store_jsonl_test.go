@@ -0,0 +1,129 @@
+package tracker
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONLStoreLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "locations.jsonl")
+
+	store, err := OpenJSONLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Save(LocationStruct{Person: 1, Location: "Node_AA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The erase and retention commands can't rewrite the file while the tracker has it open
+	_, err = OpenJSONLStore(path)
+	if err == nil {
+		t.Fatal("Store opened twice")
+	}
+
+	err = store.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err = OpenJSONLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	erased, err := store.Delete(LocationQuery{Room: "Node_AA"})
+	if err != nil || erased != 1 {
+		t.Errorf("Delete() = %d, %v, want 1 record", erased, err)
+	}
+}
+
+func TestJSONLStoreReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "locations.jsonl")
+
+	if _, err := OpenJSONLStoreReadOnly(path); err == nil {
+		t.Fatal("Opened a missing store read-only")
+	}
+	store, err := OpenJSONLStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Save(LocationStruct{Person: 1, Location: "Node_AA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenJSONLStoreReadOnly(path); err == nil {
+		t.Fatal("Opened read-only a store open to write")
+	}
+	store.Close()
+
+	// Several exports can read the store at the same time, but it can't be written meanwhile
+	reader, err := OpenJSONLStoreReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	other, err := OpenJSONLStoreReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if _, err := OpenJSONLStore(path); err == nil {
+		t.Error("Opened to write a store being read")
+	}
+	locations, err := reader.Query(LocationQuery{})
+	if err != nil || len(locations) != 1 {
+		t.Errorf("Query() = %+v, %v, want 1 location", locations, err)
+	}
+	if err := reader.Save(LocationStruct{Person: 2, Location: "Node_AA"}); err == nil {
+		t.Error("Saved a location in a read-only store")
+	}
+	if _, err := reader.Delete(LocationQuery{}); err == nil {
+		t.Error("Deleted the locations of a read-only store")
+	}
+}
+
+func TestJSONLStoreRewriteError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenJSONLStore(filepath.Join(dir, "locations.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for person := 1; person <= 2; person++ {
+		err = store.Save(LocationStruct{Person: person, Location: "Node_AA", Rfid: -50})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A record that can't be written aborts the rewrite instead of dropping it
+	person := 1
+	_, err = store.Rewrite(LocationQuery{Person: &person}, func(record LocationStruct) LocationStruct {
+		record.Rfid = math.NaN()
+		return record
+	})
+	if err == nil {
+		t.Fatal("Rewrite() of an invalid record didn't fail")
+	}
+	locations, err := store.Query(LocationQuery{})
+	if err != nil || len(locations) != 2 || locations[0].Rfid != -50 {
+		t.Errorf("Locations after a failed rewrite = %+v, %v, want both locations unchanged", locations, err)
+	}
+}
@@ -0,0 +1,29 @@
+// +build !windows
+
+package tracker
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockStore takes a lock of the store in the path, released when the returned file is closed or the
+// process exits. The exclusive lock fails when another process has the store open, and the shared
+// lock when another process has it open to write
+func lockStore(path string, exclusive bool) (*os.File, error) {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	err = syscall.Flock(int(lock.Fd()), how|syscall.LOCK_NB)
+	if err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("Location store %s is in use by another process, stop the tracker first", path)
+	}
+	return lock, nil
+}
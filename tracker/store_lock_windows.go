@@ -0,0 +1,10 @@
+package tracker
+
+import (
+	"os"
+)
+
+// lockStore only creates the lock file, the store isn't locked on Windows
+func lockStore(path string, exclusive bool) (*os.File, error) {
+	return os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+}
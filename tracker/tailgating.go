@@ -0,0 +1,31 @@
+package tracker
+
+import (
+	"fmt"
+
+	datafusion "mainprocess/datafusion"
+)
+
+// Tailgating raises the tailgating alarm of a room when the analysis of a window found persons entering
+// without badge. Returns the current alarm, if it was published and the error publishing it
+func (t *Tracker) Tailgating(room string, analysis datafusion.Tailgating) (Alarm, bool, error) {
+	if room == "" {
+		return Alarm{}, false, fmt.Errorf("Tailgating analysis without room")
+	}
+	if !analysis.Detected {
+		return Alarm{}, false, fmt.Errorf("No tailgating in room %s", room)
+	}
+
+	alarm, published, err := t.alarms.Raise(Alarm{
+		Kind:     AlarmTailgating,
+		Room:     room,
+		Reason:   fmt.Sprintf("%d persons entered with %d badges, persons without badge: %v", analysis.CameraPersons, analysis.Badges, analysis.Unbadged),
+		Severity: SeverityWarning,
+		Features: map[string]float64{
+			"camerapersons": float64(analysis.CameraPersons),
+			"badges":        float64(analysis.Badges),
+			"presence":      analysis.Presence,
+		},
+	})
+	return alarm, published, err
+}
@@ -0,0 +1,41 @@
+package tracker
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	datafusion "mainprocess/datafusion"
+)
+
+func TestTailgatingAlarm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tracker, _ := newTestTracker(t, dir, &testPublisher{})
+	defer tracker.Close()
+
+	analysis := datafusion.Tailgating{CameraPersons: 3, Badges: 1, Presence: 80, Unbadged: []int{2, 3}, Detected: true}
+	alarm, published, err := tracker.Tailgating("Node_AA", analysis)
+	if err != nil || !published {
+		t.Fatalf("Tailgating = %+v (published %v, error %v), want the alarm published", alarm, published, err)
+	}
+	if alarm.Kind != AlarmTailgating || alarm.Room != "Node_AA" || alarm.Features["camerapersons"] != 3 || alarm.Features["badges"] != 1 {
+		t.Errorf("Tailgating alarm = %+v, want the counts of the analysis", alarm)
+	}
+
+	// The next window of the same room updates the same alarm
+	again, published, _ := tracker.Tailgating("Node_AA", analysis)
+	if published || again.ID != alarm.ID || again.Count != 2 {
+		t.Errorf("Repeated tailgating = %+v (published %v), want the same alarm suppressed", again, published)
+	}
+
+	if _, _, err := tracker.Tailgating("Node_AA", datafusion.Tailgating{CameraPersons: 1, Badges: 1}); err == nil {
+		t.Error("Raised a tailgating alarm without tailgating")
+	}
+	if _, _, err := tracker.Tailgating("", analysis); err == nil {
+		t.Error("Raised a tailgating alarm without room")
+	}
+}
@@ -0,0 +1,230 @@
+package tracker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// AnomalyImpossibleMovement is published when a person moves between two rooms faster than the
+// minimum transit time between them
+const AnomalyImpossibleMovement = "impossible-movement"
+
+type (
+	// TopologyLink connects two adjacent rooms. Transit is the minimum time in seconds to move between them
+	TopologyLink struct {
+		Rooms   []string `json:"rooms" yaml:"rooms"`
+		Transit float64  `json:"transit" yaml:"transit"`
+	}
+
+	// TopologyFile is the content of a building topology file
+	TopologyFile struct {
+		Rooms []string       `json:"rooms" yaml:"rooms"`
+		Links []TopologyLink `json:"links" yaml:"links"`
+	}
+
+	// Topology has the minimum transit time between every pair of rooms of the building, going
+	// through the adjacent rooms
+	Topology struct {
+		rooms map[string]int
+		// transit is in seconds, and infinite for the rooms that aren't connected
+		transit [][]float64
+	}
+
+	// Anomaly is a physically impossible sequence of detections, which points to a cloned badge or
+	// to a wrong identity link
+	Anomaly struct {
+		Kind   string    `json:"kind"`
+		Person int       `json:"person"`
+		From   Detection `json:"from"`
+		To     Detection `json:"to"`
+		// Elapsed and MinTransit are in seconds
+		Elapsed    float64 `json:"elapsed"`
+		MinTransit float64 `json:"mintransit"`
+		// Unreachable is true when there is no path between both rooms, so no time is enough
+		Unreachable bool   `json:"unreachable"`
+		Timestamp   string `json:"timestamp"`
+	}
+
+	// sighting is the last detection of a person, with the time it happened
+	sighting struct {
+		detection Detection
+		at        time.Time
+	}
+
+	// movementChecker compares each detection of a person with the previous one
+	movementChecker struct {
+		topology *Topology
+
+		mu   sync.Mutex
+		last map[int]sighting
+		// unknown are the rooms already logged as missing in the topology
+		unknown map[string]bool
+	}
+)
+
+// LoadTopology reads the rooms and links of a YAML or JSON file
+func LoadTopology(file string) (*Topology, error) {
+	byteData, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var content TopologyFile
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		err = json.Unmarshal(byteData, &content)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(byteData, &content)
+	default:
+		return nil, fmt.Errorf("Unknown topology file format %s", filepath.Ext(file))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Can't load topology %s: %v", file, err.Error())
+	}
+	topology, err := NewTopology(content)
+	if err != nil {
+		return nil, fmt.Errorf("Can't load topology %s: %v", file, err.Error())
+	}
+	log.Infof("[Topology] Loaded %d rooms and %d links from %s", len(content.Rooms), len(content.Links), file)
+	return topology, nil
+}
+
+// NewTopology calculates the minimum transit time between every pair of rooms
+func NewTopology(content TopologyFile) (*Topology, error) {
+	t := &Topology{
+		rooms:   make(map[string]int),
+		transit: make([][]float64, len(content.Rooms)),
+	}
+	for i, room := range content.Rooms {
+		if _, ok := t.rooms[room]; ok {
+			return nil, fmt.Errorf("duplicated room %s", room)
+		}
+		t.rooms[room] = i
+		t.transit[i] = make([]float64, len(content.Rooms))
+		for j := range t.transit[i] {
+			if i != j {
+				t.transit[i][j] = math.Inf(1)
+			}
+		}
+	}
+
+	for n, link := range content.Links {
+		if len(link.Rooms) != 2 {
+			return nil, fmt.Errorf("link %d must have two rooms", n)
+		}
+		if link.Transit < 0 {
+			return nil, fmt.Errorf("link %d has a negative transit time", n)
+		}
+		a, ok := t.rooms[link.Rooms[0]]
+		if !ok {
+			return nil, fmt.Errorf("link %d has unknown room %s", n, link.Rooms[0])
+		}
+		b, ok := t.rooms[link.Rooms[1]]
+		if !ok {
+			return nil, fmt.Errorf("link %d has unknown room %s", n, link.Rooms[1])
+		}
+		t.transit[a][b] = math.Min(t.transit[a][b], link.Transit)
+		t.transit[b][a] = t.transit[a][b]
+	}
+
+	// Floyd-Warshall, so that non-adjacent rooms get the transit time of the shortest path
+	for k := range t.transit {
+		for i := range t.transit {
+			for j := range t.transit {
+				if t.transit[i][k]+t.transit[k][j] < t.transit[i][j] {
+					t.transit[i][j] = t.transit[i][k] + t.transit[k][j]
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+// MinTransit returns the minimum time to move between two rooms, and false if there is no path
+// between them. Fails if any of the rooms isn't in the topology
+func (t *Topology) MinTransit(a, b string) (time.Duration, bool, error) {
+	for _, room := range []string{a, b} {
+		if _, ok := t.rooms[room]; !ok {
+			return 0, false, fmt.Errorf("Room %s isn't in the topology", room)
+		}
+	}
+	transit := t.transit[t.rooms[a]][t.rooms[b]]
+	if math.IsInf(transit, 1) {
+		return 0, false, nil
+	}
+	return time.Duration(transit * float64(time.Second)), true, nil
+}
+
+func newMovementChecker(topology *Topology) *movementChecker {
+	return &movementChecker{topology: topology, last: make(map[int]sighting), unknown: make(map[string]bool)}
+}
+
+// check returns an anomaly when the person was detected in another room more recently than the
+// minimum transit time between both rooms, or in a room that can't be reached from the other one
+func (m *movementChecker) check(detection Detection) *Anomaly {
+	at := detectionTime(detection.Timestamp)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	last, ok := m.last[detection.Person]
+	m.last[detection.Person] = sighting{detection: detection, at: at}
+	if !ok || last.detection.Room == detection.Room {
+		return nil
+	}
+	minTransit, reachable, err := m.topology.MinTransit(last.detection.Room, detection.Room)
+	if err != nil {
+		// Each unknown room is logged once, the movements from and to it can't be checked
+		for _, room := range []string{last.detection.Room, detection.Room} {
+			if _, ok := m.topology.rooms[room]; !ok && !m.unknown[room] {
+				m.unknown[room] = true
+				log.Warnf("[Topology] Room %s isn't in the topology, its movements aren't checked", room)
+			}
+		}
+		return nil
+	}
+	elapsed := at.Sub(last.at)
+	if reachable && elapsed >= minTransit {
+		return nil
+	}
+	return &Anomaly{
+		Kind:        AnomalyImpossibleMovement,
+		Person:      detection.Person,
+		From:        last.detection,
+		To:          detection,
+		Elapsed:     elapsed.Seconds(),
+		MinTransit:  minTransit.Seconds(),
+		Unreachable: !reachable,
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}
+}
+
+// publishAnomaly logs and publishes an anomaly in the anomaly topic
+func (t *Tracker) publishAnomaly(anomaly Anomaly) error {
+	if anomaly.Unreachable {
+		log.Warnf("[Tracker] Impossible movement of user %d from %s to %s, there is no path between both rooms",
+			anomaly.Person, anomaly.From.Room, anomaly.To.Room)
+	} else {
+		log.Warnf("[Tracker] Impossible movement of user %d from %s to %s in %.1fs, the minimum is %.1fs",
+			anomaly.Person, anomaly.From.Room, anomaly.To.Room, anomaly.Elapsed, anomaly.MinTransit)
+	}
+	if t.publisher == nil || t.config.AnomalyTopic == "" {
+		return nil
+	}
+	byteData, err := json.Marshal(anomaly)
+	if err != nil {
+		return err
+	}
+	err = t.publisher.Publish(t.config.AnomalyTopic, byteData)
+	if err != nil {
+		return fmt.Errorf("Error publishing anomaly of user %d: %v", anomaly.Person, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package tracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMovementChecker(t *testing.T) {
+	topology, err := NewTopology(TopologyFile{
+		Rooms: []string{"A", "B", "C", "Isolated"},
+		Links: []TopologyLink{{Rooms: []string{"A", "B"}, Transit: 10}, {Rooms: []string{"B", "C"}, Transit: 20}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	detection := func(room string, seconds int) Detection {
+		return Detection{Person: 1, Room: room, Timestamp: start.Add(time.Duration(seconds) * time.Second).Format(time.RFC3339)}
+	}
+
+	tests := []struct {
+		name        string
+		from, to    Detection
+		anomaly     bool
+		unreachable bool
+	}{
+		{"possible movement", detection("A", 0), detection("C", 40), false, false},
+		{"too fast", detection("A", 0), detection("C", 20), true, false},
+		{"no path", detection("A", 0), detection("Isolated", 3600), true, true},
+		{"unknown room", detection("A", 0), detection("Unknown", 1), false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker := newMovementChecker(topology)
+			checker.check(test.from)
+			anomaly := checker.check(test.to)
+			if (anomaly != nil) != test.anomaly {
+				t.Fatalf("check() = %+v, want anomaly %v", anomaly, test.anomaly)
+			}
+			if anomaly != nil && anomaly.Unreachable != test.unreachable {
+				t.Errorf("Unreachable = %v, want %v", anomaly.Unreachable, test.unreachable)
+			}
+		})
+	}
+}
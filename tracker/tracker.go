@@ -2,59 +2,298 @@ package tracker
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	datafusion "mainprocess/datafusion"
 
 	log "github.com/sirupsen/logrus"
 )
 
-type LocationStruct struct {
-	Timestamp string
-	Person    int
-	Location  string
-	Alarm     bool
-	Rfid      float64
-	Wifi      float64
-	Counter   int
-}
-
-// CheckPermissionsAndStoreEntry checks the permission of a user to be in a room and then decides if the entry is saved in DDBB
-func CheckPermissionsAndStoreEntry(info map[string]interface{}, nodeID string, changeCounterRfid, changeCounterWifi float64) {
-	var newDetectionData LocationStruct
-	if val, ok := info["person"]; !ok {
-		newDetectionData.Person = 0
-	} else {
-		newDetectionData.Person = int(val.(float64))
-	}
-	if val, ok := info["timestamp"]; ok {
-		newDetectionData.Timestamp = val.(string)
-	}
-	if val, ok := info["rfidpower"]; ok {
-		newDetectionData.Rfid = val.(float64)
-	}
-	if val, ok := info["wifirssi"]; ok {
-		newDetectionData.Wifi = val.(float64)
-	}
-	newDetectionData.Location = nodeID
-	newDetectionData.Counter = 0
-	log.Infof("Proceeding to check if user %d is allowed to be in the room %s", newDetectionData.Person, newDetectionData.Location)
-	// Add check to database. If not allowed, generate alarm
-	var allowed bool = true
-	newDetectionData.Alarm = allowed
-	if !allowed {
-		// Generate alarm
-	}
-
-	// Get last user detection and compare using counters & roomName. Then decide if store data of not
-	err := storeLogInDatabase(newDetectionData)
+type (
+	// LocationStruct is the location log of a person stored by the tracker
+	LocationStruct struct {
+		Timestamp string
+		Person    int
+		Location  string
+		Alarm     bool
+		Rfid      float64
+		Wifi      float64
+		Counter   int
+		// Recorded is the time when the location was stored, used to query the history
+		Recorded time.Time
+	}
+
+	// Detection is a positive prediction of a person in a room
+	Detection struct {
+		Timestamp  string  `json:"timestamp"`
+		Person     int     `json:"person"`
+		Room       string  `json:"room"`
+		Presence   float64 `json:"presence"`
+		RfidUser   float64 `json:"rfiduser"`
+		RfidPower  float64 `json:"rfidpower"`
+		CameraUser float64 `json:"camerauser"`
+		WifiUser   float64 `json:"wifiuser"`
+		WifiRssi   float64 `json:"wifirssi"`
+		Window     string  `json:"window,omitempty"`
+	}
+
+	// Result is what the tracker did with a detection
+	Result struct {
+		Decision Decision
+		// Alarm is the alarm of the person in the room, nil when the person is allowed
+		Alarm *Alarm
+		// AlarmPublished is false when the alarm was suppressed by the cooldown
+		AlarmPublished bool
+		// Stored is the location stored, nil when the detection didn't change the location of the person
+		Stored *LocationStruct
+		// Occupancy has the rooms whose number of persons changed with the detection
+		Occupancy []RoomOccupancy
+		// Anomaly is the impossible movement of the person to the room, nil when it's possible
+		Anomaly *Anomaly
+	}
+
+	// Stats counts the detections processed by the tracker
+	Stats struct {
+		Detections uint64
+		Errors     uint64
+		Alarms     uint64
+		Stored     uint64
+		Anomalies  uint64
+	}
+
+	// Tracker checks the permissions of the detections, raises the alarms and stores the location changes
+	Tracker struct {
+		config    Config
+		publisher Publisher
+		// permissions has the rules used to check each detection. When nil, every person is allowed in every room
+		permissions *PermissionStore
+		alarms      *AlarmManager
+		// store keeps the history of locations. When nil, the locations are only logged
+		store     LocationStore
+		positions *positionTracker
+		occupancy *occupancy
+		// movements checks the movements of the persons with the building topology. Nil without topology
+		movements *movementChecker
+		done      chan struct{}
+
+		// escortMu protects escorted, the last time each unauthorized person was seen with an escort
+		escortMu sync.Mutex
+		escorted map[int]escortState
+
+		detections uint64
+		errors     uint64
+		raised     uint64
+		stored     uint64
+		anomalies  uint64
+	}
+)
+
+// NewDetection creates the detection of a prediction in a room
+func NewDetection(prediction datafusion.PredictionDataStruct, room string) Detection {
+	return Detection{
+		Timestamp:  prediction.Timestamp,
+		Person:     prediction.Person,
+		Room:       room,
+		Presence:   prediction.Presence,
+		RfidUser:   prediction.RfidUser,
+		RfidPower:  prediction.RfidPower,
+		CameraUser: prediction.CameraUser,
+		WifiUser:   prediction.WifiUser,
+		WifiRssi:   prediction.WifiRssi,
+		Window:     prediction.Window,
+	}
+}
+
+// Features returns the features of the detection, which are attached to the alarms
+func (d Detection) Features() map[string]float64 {
+	return map[string]float64{
+		"presence":   d.Presence,
+		"rfiduser":   d.RfidUser,
+		"rfidpower":  d.RfidPower,
+		"camerauser": d.CameraUser,
+		"wifiuser":   d.WifiUser,
+		"wifirssi":   d.WifiRssi,
+	}
+}
+
+// windowKey identifies the window of the detection, using the timestamp when it has no window
+func (d Detection) windowKey() string {
+	if d.Window != "" {
+		return d.Window
+	}
+	return d.Timestamp
+}
+
+// newLocation creates the location log of a detection
+func newLocation(detection Detection) LocationStruct {
+	return LocationStruct{
+		Timestamp: detection.Timestamp,
+		Person:    detection.Person,
+		Location:  detection.Room,
+		Rfid:      detection.RfidPower,
+		Wifi:      detection.WifiRssi,
+	}
+}
+
+// Alarms returns the alarm manager of the tracker
+func (t *Tracker) Alarms() *AlarmManager {
+	return t.alarms
+}
+
+// Store returns the storage backend of the location logs
+func (t *Tracker) Store() LocationStore {
+	return t.store
+}
+
+// Stats returns the number of detections processed, the errors, the alarms raised or published again
+// after the cooldown, the locations stored and the anomalies found
+func (t *Tracker) Stats() Stats {
+	return Stats{
+		Detections: atomic.LoadUint64(&t.detections),
+		Errors:     atomic.LoadUint64(&t.errors),
+		Alarms:     atomic.LoadUint64(&t.raised),
+		Stored:     atomic.LoadUint64(&t.stored),
+		Anomalies:  atomic.LoadUint64(&t.anomalies),
+	}
+}
+
+// Process checks the permission of a person to be in a room, raises an alarm when it isn't allowed and
+// stores the location when it changed. The result has everything done before an error happened
+func (t *Tracker) Process(detection Detection) (Result, error) {
+	results, err := t.ProcessWindow([]Detection{detection})
+	return results[0], err
+}
+
+// ProcessWindow processes the detections of the same window together, so that the unauthorized persons
+// detected with an escort don't raise alarms. Returns the result of each detection, and the errors of
+// all of them
+func (t *Tracker) ProcessWindow(detections []Detection) ([]Result, error) {
+	decisions := make([]Decision, len(detections))
+	for i, detection := range detections {
+		decisions[i] = t.decide(detection)
+	}
+	t.applyEscorts(detections, decisions)
+	// The signals of the whole window are known before confirming any location change
+	for _, detection := range detections {
+		t.positions.observe(newLocation(detection), detection.windowKey())
+	}
+
+	results := make([]Result, len(detections))
+	var errs []string
+	for i, detection := range detections {
+		atomic.AddUint64(&t.detections, 1)
+		result, err := t.process(detection, decisions[i])
+		// The repeated alarms suppressed by the cooldown aren't counted again
+		if result.Alarm != nil && (result.AlarmPublished || result.Alarm.Count == 1) {
+			atomic.AddUint64(&t.raised, 1)
+		}
+		if result.Stored != nil {
+			atomic.AddUint64(&t.stored, 1)
+		}
+		if result.Anomaly != nil {
+			atomic.AddUint64(&t.anomalies, 1)
+		}
+		if err != nil {
+			atomic.AddUint64(&t.errors, 1)
+			errs = append(errs, err.Error())
+		}
+		results[i] = result
+	}
+	if len(errs) > 0 {
+		return results, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return results, nil
+}
+
+// decide checks the permission rules of a detection
+func (t *Tracker) decide(detection Detection) Decision {
+	if t.permissions == nil {
+		return Decision{Allowed: true, Reason: "no permission rules loaded"}
+	}
+	log.Infof("Proceeding to check if user %d is allowed to be in the room %s", detection.Person, detection.Room)
+	return t.permissions.Check(detection.Person, detection.Room, detectionTime(detection.Timestamp))
+}
+
+func (t *Tracker) process(detection Detection, decision Decision) (Result, error) {
+	result := Result{Decision: decision}
+	if detection.Room == "" {
+		return result, fmt.Errorf("Detection of user %d without room", detection.Person)
+	}
+
+	newDetectionData := newLocation(detection)
+	log.Infof("User %d in room %s: %s", newDetectionData.Person, newDetectionData.Location, result.Decision.Reason)
+	newDetectionData.Alarm = !result.Decision.Allowed && !result.Decision.Escorted
+
+	// The location is stored even if the anomaly or the alarm couldn't be published
+	var publishErrs []string
+	if t.movements != nil {
+		result.Anomaly = t.movements.check(detection)
+		if result.Anomaly != nil {
+			err := t.publishAnomaly(*result.Anomaly)
+			if err != nil {
+				publishErrs = append(publishErrs, err.Error())
+			}
+		}
+	}
+	if newDetectionData.Alarm {
+		severity := SeverityWarning
+		if result.Decision.Denied {
+			severity = SeverityCritical
+		}
+		alarm, published, err := t.alarms.Raise(Alarm{
+			Person:   newDetectionData.Person,
+			Room:     newDetectionData.Location,
+			Reason:   result.Decision.Reason,
+			Severity: severity,
+			Features: detection.Features(),
+		})
+		result.Alarm = &alarm
+		result.AlarmPublished = published
+		if err != nil {
+			publishErrs = append(publishErrs, err.Error())
+		}
+	}
+
+	// Only the first location of the user and the confirmed location changes are stored
+	location, changed, err := t.positions.update(newDetectionData, detection.windowKey(), t.config.ChangeCounter, t.config.ChangeCounterRfid, t.config.ChangeCounterWifi)
 	if err != nil {
-		log.Errorf(err.Error())
+		return result, err
 	}
+	if changed {
+		location, err = t.storeLogInDatabase(location)
+		if err != nil {
+			return result, fmt.Errorf("Unable to store location of user %d: %v", location.Person, err.Error())
+		}
+		result.Stored = &location
+	}
+
+	// The person is only counted in the confirmed location, not while moving to another room
+	if room, ok := t.positions.location(detection.Person); ok && room == detection.Room {
+		result.Occupancy = t.occupancy.enter(detection.Person, room, time.Now())
+		err = t.updateOccupancy(result.Occupancy)
+		if err != nil {
+			return result, err
+		}
+	}
+	if len(publishErrs) > 0 {
+		return result, fmt.Errorf("%s", strings.Join(publishErrs, "; "))
+	}
+	return result, nil
 }
 
-func storeLogInDatabase(info LocationStruct) error {
+func (t *Tracker) storeLogInDatabase(info LocationStruct) (LocationStruct, error) {
+	info.Recorded = time.Now()
 	data, err := json.MarshalIndent(info, "", "  ")
 	if err != nil {
-		return err
+		return info, err
 	}
 	log.Infof("%v", string(data))
-	return nil
+	if t.store == nil {
+		return info, nil
+	}
+	return info, t.store.Save(info)
 }
@@ -0,0 +1,113 @@
+package tracker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testConfig stores the locations in a JSON lines file of the directory, where person 1 is only
+// allowed in Node_AA
+func testConfig(t *testing.T, dir string) Config {
+	return Config{
+		PermissionsFile:   writeFile(t, dir, "permissions.yaml", "rules:\n  - persons: [1]\n    rooms: [Node_AA]\n"),
+		AlarmTopic:        "/Tracking/Alarms",
+		AlarmClearTopic:   "/Tracking/Alarms/Clear",
+		AlarmCooldown:     time.Minute,
+		Storage:           StorageJSONL,
+		StoragePath:       filepath.Join(dir, "locations.jsonl"),
+		ChangeCounter:     1,
+		ChangeCounterRfid: 5,
+		ChangeCounterWifi: 5,
+	}
+}
+
+// newTestTracker creates a tracker with the test configuration
+func newTestTracker(t *testing.T, dir string, publisher Publisher) (*Tracker, Config) {
+	config := testConfig(t, dir)
+	tracker, err := New(config, publisher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tracker, config
+}
+
+func TestTrackerProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	publisher := &testPublisher{}
+	tracker, config := newTestTracker(t, dir, publisher)
+	defer tracker.Close()
+
+	result, err := tracker.Process(Detection{Timestamp: "1", Person: 1, Room: "Node_AA", RfidPower: -50, WifiRssi: -60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Decision.Allowed || result.Alarm != nil || result.Stored == nil {
+		t.Errorf("Result of an allowed person = %+v, want the location stored without alarm", result)
+	}
+
+	result, err = tracker.Process(Detection{Timestamp: "1", Person: 2, Room: "Node_AA", RfidPower: -50, WifiRssi: -60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Decision.Allowed || result.Alarm == nil || !result.AlarmPublished || result.Stored == nil || !result.Stored.Alarm {
+		t.Fatalf("Result of a person without permission = %+v, want a published alarm and the location stored", result)
+	}
+	if result.Alarm.Features["rfidpower"] != -50 {
+		t.Errorf("Alarm features = %v, want the features of the detection", result.Alarm.Features)
+	}
+	if alarms := publisher.alarms(t, config.AlarmTopic); len(alarms) != 1 || alarms[0].Person != 2 {
+		t.Errorf("Published alarms = %+v, want the alarm of person 2", alarms)
+	}
+
+	// A repeated alarm suppressed by the cooldown isn't counted
+	result, err = tracker.Process(Detection{Timestamp: "2", Person: 2, Room: "Node_AA", RfidPower: -50, WifiRssi: -60})
+	if err != nil || result.Alarm == nil || result.AlarmPublished {
+		t.Errorf("Result of a repeated alarm = %+v (error %v), want the alarm suppressed", result, err)
+	}
+
+	// The same room again doesn't store a new location
+	result, err = tracker.Process(Detection{Timestamp: "2", Person: 1, Room: "Node_AA", RfidPower: -50, WifiRssi: -60})
+	if err != nil || result.Stored != nil {
+		t.Errorf("Result of a repeated detection = %+v (error %v), want nothing stored", result, err)
+	}
+	if _, err := tracker.Process(Detection{Person: 1}); err == nil {
+		t.Error("Processed a detection without room")
+	}
+
+	stats := tracker.Stats()
+	if stats.Detections != 5 || stats.Errors != 1 || stats.Alarms != 1 || stats.Stored != 2 {
+		t.Errorf("Stats = %+v, want 5 detections, 1 error, 1 alarm and 2 stored", stats)
+	}
+	locations, err := tracker.Store().Query(LocationQuery{Room: "Node_AA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 2 {
+		t.Errorf("Stored locations = %+v, want 2", locations)
+	}
+}
+
+func TestTrackerStoresWhenAlarmFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tracker, _ := newTestTracker(t, dir, &testPublisher{broken: true})
+	defer tracker.Close()
+
+	result, err := tracker.Process(Detection{Timestamp: "1", Person: 2, Room: "Node_AA"})
+	if err == nil {
+		t.Error("Alarm publish error not returned")
+	}
+	if result.Alarm == nil || result.AlarmPublished || result.Stored == nil {
+		t.Errorf("Result = %+v, want the alarm not published and the location stored", result)
+	}
+}
@@ -0,0 +1,113 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultMemoryBuffer is the number of messages of each subscription waiting to be handled when
+// the Buffer of the Memory transport isn't set
+const DefaultMemoryBuffer = 1024
+
+type (
+	// Memory delivers the messages published to the subscriptions of the same process, so the sensors
+	// and the pipeline can run without a broker. Each subscription receives its messages in the
+	// order they were published
+	Memory struct {
+		// Buffer is the number of messages of each subscription waiting to be handled. When a
+		// subscription has its buffer full, Publish blocks until its handler takes a message, so a
+		// slow handler slows down the publishers instead of losing messages. It's used by the
+		// subscriptions created after setting it, and 0 uses DefaultMemoryBuffer
+		Buffer int
+
+		mu            sync.RWMutex
+		subscriptions []*memorySubscription
+		closed        bool
+	}
+
+	memorySubscription struct {
+		filter   string
+		handler  Handler
+		messages chan Message
+		done     chan struct{}
+	}
+)
+
+// NewMemory creates an in-process transport
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Subscribe receives the messages published to the topics matching the filter
+func (m *Memory) Subscribe(topic string, handler Handler) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return fmt.Errorf("Transport closed")
+	}
+
+	buffer := m.Buffer
+	if buffer <= 0 {
+		buffer = DefaultMemoryBuffer
+	}
+	subscription := &memorySubscription{
+		filter:   topic,
+		handler:  handler,
+		messages: make(chan Message, buffer),
+		done:     make(chan struct{}),
+	}
+	m.subscriptions = append(m.subscriptions, subscription)
+	go subscription.run()
+	return nil
+}
+
+// Publish sends a copy of the payload to the subscriptions of the topic
+func (m *Memory) Publish(topic string, payload []byte) error {
+	m.mu.RLock()
+	if m.closed {
+		m.mu.RUnlock()
+		return fmt.Errorf("Transport closed")
+	}
+	var subscriptions []*memorySubscription
+	for _, subscription := range m.subscriptions {
+		if Match(subscription.filter, topic) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	m.mu.RUnlock()
+
+	now := time.Now()
+	for _, subscription := range subscriptions {
+		message := Message{Topic: topic, Payload: append([]byte(nil), payload...), Time: now}
+		select {
+		case subscription.messages <- message:
+		case <-subscription.done:
+		}
+	}
+	return nil
+}
+
+// Close stops the delivery of the messages. The messages not handled yet are discarded
+func (m *Memory) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	for _, subscription := range m.subscriptions {
+		close(subscription.done)
+	}
+}
+
+func (s *memorySubscription) run() {
+	for {
+		select {
+		case message := <-s.messages:
+			s.handler(message)
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package transport
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"/Nodes/Node_ID/Tracking/Sensor/+", "/Nodes/Node_ID/Tracking/Sensor/camera", true},
+		{"/Nodes/Node_ID/Tracking/Sensor/+", "/Nodes/Node_ID/Tracking/Sensor", false},
+		{"/Nodes/Node_ID/Tracking/Sensor/+", "/Nodes/Node_ID/Tracking/Sensor/camera/1", false},
+		{"/Nodes/+/Tracking/Detection", "/Nodes/Node_AA/Tracking/Detection", true},
+		{"/Nodes/#", "/Nodes/Node_AA/Tracking/Detection", true},
+		{"/Nodes/Node_AA/Tracking/Detection", "/Nodes/Node_BB/Tracking/Detection", false},
+	}
+	for _, test := range tests {
+		if got := Match(test.filter, test.topic); got != test.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", test.filter, test.topic, got, test.want)
+		}
+	}
+}
+
+func TestMemoryDeliversInOrder(t *testing.T) {
+	memory := NewMemory()
+	defer memory.Close()
+	received := make(chan string, 10)
+	err := memory.Subscribe("/Nodes/Node_ID/Tracking/Sensor/+", func(msg Message) {
+		received <- string(msg.Payload)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		err = memory.Publish("/Nodes/Node_ID/Tracking/Sensor/camera", []byte(fmt.Sprint(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	memory.Publish("/Nodes/Node_AA/Tracking/Detection", []byte("other"))
+	for i := 0; i < 5; i++ {
+		select {
+		case payload := <-received:
+			if payload != fmt.Sprint(i) {
+				t.Fatalf("Received %s, want %d", payload, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Message %d not delivered", i)
+		}
+	}
+	select {
+	case payload := <-received:
+		t.Errorf("Received %s from a topic not subscribed", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryClose(t *testing.T) {
+	memory := NewMemory()
+	err := memory.Subscribe("#", func(msg Message) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory.Close()
+	memory.Close()
+	if memory.Publish("/Nodes/Node_ID/Tracking/Sensor/camera", nil) == nil {
+		t.Error("Published after Close")
+	}
+	if memory.Subscribe("#", func(msg Message) {}) == nil {
+		t.Error("Subscribed after Close")
+	}
+}
+
+func TestMemoryBufferBlocksPublish(t *testing.T) {
+	memory := NewMemory()
+	memory.Buffer = 1
+	defer memory.Close()
+	release := make(chan struct{})
+	handled := make(chan struct{}, 10)
+	err := memory.Subscribe("#", func(msg Message) {
+		<-release
+		handled <- struct{}{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first message is being handled and the second one fills the buffer, so the third one waits
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			memory.Publish("/Nodes/Node_ID/Tracking/Sensor/camera", []byte(fmt.Sprint(i)))
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("Publish didn't wait for the full buffer")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked after the handler took the messages")
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatalf("Message %d not handled", i)
+		}
+	}
+}
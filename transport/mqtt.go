@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// MQTTConfig has the settings of the connection to the MQTT broker
+	MQTTConfig struct {
+		Server      string
+		ClientID    string
+		KeepAlive   time.Duration
+		PingTimeout time.Duration
+	}
+
+	// MQTT is the transport of a MQTT broker. The subscriptions are kept, so they are done again
+	// every time the client connects
+	MQTT struct {
+		client mqtt.Client
+
+		mu            sync.Mutex
+		subscriptions map[string]Handler
+		subscribed    bool
+	}
+)
+
+// NewMQTT creates the transport of a MQTT broker. It isn't connected until Connect is called
+func NewMQTT(config MQTTConfig) *MQTT {
+	m := &MQTT{subscriptions: make(map[string]Handler)}
+	opts := mqtt.NewClientOptions().AddBroker(config.Server).SetClientID(config.ClientID)
+	opts.SetKeepAlive(config.KeepAlive)
+	opts.SetPingTimeout(config.PingTimeout)
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		err := m.subscribeAll()
+		if err != nil {
+			log.Errorf("[MQTT] Unable to subscribe: %v", err.Error())
+		}
+		m.setSubscribed(err == nil)
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		log.Warnf("[MQTT] Connection lost: %v", err.Error())
+		m.setSubscribed(false)
+	})
+	m.client = mqtt.NewClient(opts)
+	return m
+}
+
+// Connect connects to the broker and subscribes to the topics
+func (m *MQTT) Connect() error {
+	log.Infof("[MQTT] Connecting to MQTT broker...")
+	if token := m.client.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+// Close disconnects from the broker, waiting a moment for the messages being sent
+func (m *MQTT) Close() {
+	m.client.Disconnect(250)
+}
+
+// Subscribe receives the messages of a topic. When the client isn't connected, it subscribes once connected
+func (m *MQTT) Subscribe(topic string, handler Handler) error {
+	m.mu.Lock()
+	m.subscriptions[topic] = handler
+	m.mu.Unlock()
+	if !m.client.IsConnected() {
+		return nil
+	}
+	err := m.subscribe(topic, handler)
+	if err != nil {
+		m.setSubscribed(false)
+	}
+	return err
+}
+
+// Unsubscribe stops receiving the messages of the topics
+func (m *MQTT) Unsubscribe(topics ...string) error {
+	m.mu.Lock()
+	for _, topic := range topics {
+		delete(m.subscriptions, topic)
+	}
+	m.mu.Unlock()
+	if token := m.client.Unsubscribe(topics...); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+// Connected returns if the connection to the broker is open
+func (m *MQTT) Connected() bool {
+	return m.client.IsConnectionOpen()
+}
+
+// Subscribed returns if every subscription was accepted by the broker since the last connection
+func (m *MQTT) Subscribed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.subscribed && m.client.IsConnectionOpen()
+}
+
+func (m *MQTT) setSubscribed(subscribed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscribed = subscribed
+}
+
+// Publish sends a payload to a topic of the broker
+func (m *MQTT) Publish(topic string, payload []byte) error {
+	token := m.client.Publish(topic, 0, false, payload)
+	if token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+func (m *MQTT) subscribeAll() error {
+	log.Infof("[MQTT] Subscribing to MQTT Topics...")
+	m.mu.Lock()
+	subscriptions := make(map[string]Handler, len(m.subscriptions))
+	for topic, handler := range m.subscriptions {
+		subscriptions[topic] = handler
+	}
+	m.mu.Unlock()
+
+	for topic, handler := range subscriptions {
+		err := m.subscribe(topic, handler)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MQTT) subscribe(topic string, handler Handler) error {
+	callback := func(client mqtt.Client, msg mqtt.Message) {
+		handler(Message{Topic: msg.Topic(), Payload: msg.Payload(), Time: time.Now()})
+	}
+	if token := m.client.Subscribe(topic, 0, callback); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
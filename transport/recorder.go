@@ -0,0 +1,140 @@
+package transport
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// recorderFlush is how often the recorded messages are written to the file
+const recorderFlush = time.Second
+
+// Recorder writes the received messages to a recording, one JSON record per line. Recordings ending
+// in .gz are written uncompressed to the file with .part appended, and compressed when the recorder
+// is closed, so the messages recorded before a crash can always be read
+type Recorder struct {
+	// compressed is the gzip recording where the file is compressed on Close. Empty for plain recordings
+	compressed string
+
+	mu      sync.Mutex
+	file    *os.File
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+	done    chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewRecorder appends the messages to the recording in the file
+func NewRecorder(file string) (*Recorder, error) {
+	r := &Recorder{done: make(chan struct{})}
+	if strings.HasSuffix(file, ".gz") {
+		r.compressed = file
+		file += ".part"
+		if _, err := os.Stat(file); err == nil {
+			log.Warnf("[Recorder] Continuing the recording %s left by a previous run", file)
+		}
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	r.file = f
+	r.buffer = bufio.NewWriter(f)
+	r.encoder = json.NewEncoder(r.buffer)
+	go r.flushLoop()
+	return r, nil
+}
+
+// Record writes a message with its arrival time
+func (r *Recorder) Record(message Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.encoder.Encode(Record{Time: message.Time, Topic: message.Topic, Payload: string(message.Payload)})
+}
+
+// Handler records each message before passing it to the handler
+func (r *Recorder) Handler(handler Handler) Handler {
+	return func(message Message) {
+		err := r.Record(message)
+		if err != nil {
+			log.Errorf("[Recorder] Unable to record message of %s: %v", message.Topic, err.Error())
+		}
+		handler(message)
+	}
+}
+
+// Close writes the pending messages and closes the file. Compressed recordings are appended to the
+// gzip file as a new member, which are read as a single stream. Closing again returns the same error
+func (r *Recorder) Close() error {
+	r.closeOnce.Do(func() {
+		r.closeErr = r.close()
+	})
+	return r.closeErr
+}
+
+func (r *Recorder) close() error {
+	close(r.done)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := firstError(r.buffer.Flush(), r.file.Close())
+	if err != nil || r.compressed == "" {
+		return err
+	}
+	err = compressFile(r.file.Name(), r.compressed)
+	if err != nil {
+		return err
+	}
+	return os.Remove(r.file.Name())
+}
+
+func (r *Recorder) flushLoop() {
+	ticker := time.NewTicker(recorderFlush)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.Lock()
+			err := r.buffer.Flush()
+			r.mu.Unlock()
+			if err != nil {
+				log.Errorf("[Recorder] Unable to write recording: %v", err.Error())
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// compressFile appends the content of the file to the gzip file as a new member
+func compressFile(file, compressed string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(compressed, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(out)
+	_, err = io.Copy(writer, in)
+	err = firstError(err, writer.Close())
+	err = firstError(err, out.Sync())
+	return firstError(err, out.Close())
+}
+
+func firstError(err, next error) error {
+	if err != nil {
+		return err
+	}
+	return next
+}
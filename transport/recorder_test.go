@@ -0,0 +1,130 @@
+package transport
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func testMessage(i int) Message {
+	return Message{Topic: "/Nodes/Node_ID/Tracking/Sensor/Camera", Payload: []byte(fmt.Sprintf(`{"person": %d}`, i)), Time: time.Unix(int64(i), 0)}
+}
+
+// truncate removes the last bytes of a file, like a crash while writing it
+func truncate(t *testing.T, file string, bytes int64) {
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Truncate(file, info.Size()-bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplayTruncatedRecording(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "messages.jsonl")
+	recorder, err := NewRecorder(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		recorder.Record(testMessage(i))
+	}
+	err = recorder.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncate(t, file, 10)
+
+	replay, err := OpenReplay(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replay.Records()) != 2 {
+		t.Errorf("Records = %d, want 2", len(replay.Records()))
+	}
+}
+
+func TestReplayTruncatedGzip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "messages.jsonl.gz")
+
+	// A complete member, and a member that was flushed but never closed
+	for member, closed := range []bool{true, false} {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer := gzip.NewWriter(f)
+		encoder := json.NewEncoder(writer)
+		for i := 0; i < 3; i++ {
+			message := testMessage(member*3 + i)
+			encoder.Encode(Record{Time: message.Time, Topic: message.Topic, Payload: string(message.Payload)})
+		}
+		if closed {
+			writer.Close()
+		} else {
+			writer.Flush()
+		}
+		f.Close()
+	}
+	truncate(t, file, 2)
+
+	replay, err := OpenReplay(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replay.Records()) != 6 {
+		t.Errorf("Records = %d, want 6", len(replay.Records()))
+	}
+}
+
+func TestRecorderCompressesOnClose(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "messages.jsonl.gz")
+
+	for run := 0; run < 2; run++ {
+		recorder, err := NewRecorder(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder.Record(testMessage(run))
+		err = recorder.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Closing twice doesn't compress the recording again
+		err = recorder.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(file + ".part"); !os.IsNotExist(err) {
+		t.Errorf("Uncompressed recording not removed: %v", err)
+	}
+	replay, err := OpenReplay(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replay.Records()) != 2 {
+		t.Errorf("Records = %d, want 2", len(replay.Records()))
+	}
+}
@@ -0,0 +1,146 @@
+package transport
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type (
+	// Record is a message as it's written in the recordings
+	Record struct {
+		Time    time.Time `json:"time"`
+		Topic   string    `json:"topic"`
+		Payload string    `json:"payload"`
+	}
+
+	// Replay delivers the recorded messages to the subscriptions, and the messages published while
+	// replaying them. The messages are handled one by one, in the order of the recording
+	Replay struct {
+		records []Record
+
+		mu            sync.RWMutex
+		subscriptions []replaySubscription
+	}
+
+	replaySubscription struct {
+		filter  string
+		handler Handler
+	}
+)
+
+// ReadRecords reads the recorded messages, one JSON record per line. A recording cut by a crash
+// returns the complete records: the unfinished last line and an unexpected end of the compressed
+// stream are ignored
+func ReadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		byteData, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		complete := len(byteData) > 0 && byteData[len(byteData)-1] == '\n'
+		if len(strings.TrimSpace(string(byteData))) > 0 {
+			var record Record
+			errRecord := json.Unmarshal(byteData, &record)
+			switch {
+			case errRecord == nil:
+				records = append(records, record)
+			case complete:
+				return nil, fmt.Errorf("Invalid record in line %d: %v", line, errRecord.Error())
+			default:
+				log.Warnf("[Replay] Ignoring the unfinished record in line %d", line)
+			}
+		}
+		if err == io.ErrUnexpectedEOF {
+			log.Warnf("[Replay] Recording ended unexpectedly after %d records", len(records))
+		}
+		if err != nil {
+			return records, nil
+		}
+	}
+}
+
+// OpenReplay reads the recording of a file, which can be compressed with gzip
+func OpenReplay(file string) (*Replay, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buffered := bufio.NewReader(f)
+	var r io.Reader = buffered
+	if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		compressed, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("Can't read recording %s: %v", file, err.Error())
+		}
+		defer compressed.Close()
+		r = compressed
+	}
+	records, err := ReadRecords(r)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read recording %s: %v", file, err.Error())
+	}
+	return NewReplay(records), nil
+}
+
+// NewReplay creates the replay of the recorded messages
+func NewReplay(records []Record) *Replay {
+	return &Replay{records: records}
+}
+
+// Records returns the recorded messages
+func (r *Replay) Records() []Record {
+	return r.records
+}
+
+// Subscribe receives the recorded and published messages of the topics matching the filter
+func (r *Replay) Subscribe(topic string, handler Handler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subscriptions = append(r.subscriptions, replaySubscription{filter: topic, handler: handler})
+	return nil
+}
+
+// Publish delivers the payload to the subscriptions of the topic before returning
+func (r *Replay) Publish(topic string, payload []byte) error {
+	r.deliver(Message{Topic: topic, Payload: payload, Time: time.Now()})
+	return nil
+}
+
+// Run delivers the recorded messages. With realtime, it waits between the messages the same time
+// as between their recording. Otherwise they are delivered as fast as they are handled
+func (r *Replay) Run(realtime bool) {
+	for i, record := range r.records {
+		if realtime && i > 0 {
+			time.Sleep(record.Time.Sub(r.records[i-1].Time))
+		}
+		r.deliver(Message{Topic: record.Topic, Payload: []byte(record.Payload), Time: record.Time})
+	}
+}
+
+func (r *Replay) deliver(message Message) {
+	r.mu.RLock()
+	var handlers []Handler
+	for _, subscription := range r.subscriptions {
+		if Match(subscription.filter, message.Topic) {
+			handlers = append(handlers, subscription.handler)
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(message)
+	}
+}
@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"strings"
+	"time"
+)
+
+type (
+	// Message is a payload received in a topic
+	Message struct {
+		Topic   string
+		Payload []byte
+		// Time is when the message was received, or when it was recorded for the replayed messages
+		Time time.Time
+	}
+
+	// Handler is called with each message received in a subscribed topic
+	Handler func(Message)
+
+	// Transport receives the messages of the subscribed topics and publishes messages to other topics
+	Transport interface {
+		Subscribe(topic string, handler Handler) error
+		Publish(topic string, payload []byte) error
+	}
+
+	// Status is implemented by the transports connected to a broker. The transports without it are
+	// always connected
+	Status interface {
+		// Connected returns if the connection to the broker is open
+		Connected() bool
+		// Subscribed returns if every subscription was accepted by the broker since the last connection
+		Subscribed() bool
+	}
+)
+
+// Match returns if a topic matches a subscription filter, which can use the MQTT wildcards: + for a
+// single level and # for the remaining levels
+func Match(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}